@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptInterval is how long the pool runs at one size before it is reconsidered
+	adaptInterval = 20 * time.Second
+	// throughputDropRatio is how far the throughput per worker may fall after
+	// growing the pool before that growth is undone
+	throughputDropRatio = 0.6
+	// growthHold is how many intervals the pool keeps its size after a growth
+	// was undone; each further failed growth doubles it up to maxGrowthHold
+	growthHold    = 3
+	maxGrowthHold = 24
+)
+
+// concurrencyController adjusts how many workers of the pool may take new
+// tasks. Workers with an ID above the limit finish their current file and then
+// wait. A nil controller never limits anything.
+type concurrencyController struct {
+	mutex    sync.Mutex
+	limit    int
+	min, max int
+	finished bool
+	changed  chan struct{}
+
+	// throttled counts rate limit and timeout errors since the last decision
+	throttled int
+	// baseline is the throughput per worker measured before the last growth
+	baseline float64
+	// hold counts the intervals left before the pool may grow again, and
+	// backoff is the hold after the next growth that has to be undone
+	hold, backoff int
+}
+
+// newConcurrencyController starts with config.WorkerCount workers, kept within
+// the --min-workers and --max-workers bounds
+func newConcurrencyController(config Config) *concurrencyController {
+	limit := max(config.MinWorkers, min(config.WorkerCount, config.MaxWorkers))
+	return &concurrencyController{
+		limit:   limit,
+		min:     config.MinWorkers,
+		max:     config.MaxWorkers,
+		changed: make(chan struct{}),
+		backoff: growthHold,
+	}
+}
+
+// broadcast wakes every waiting worker; the caller must hold the mutex
+func (c *concurrencyController) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait blocks while the worker is above the limit. It returns when the worker
+// may take a task, when there are no tasks left or when the context is done.
+func (c *concurrencyController) wait(ctx context.Context, workerID int) {
+	if c == nil {
+		return
+	}
+	for {
+		c.mutex.Lock()
+		if workerID <= c.limit || c.finished {
+			c.mutex.Unlock()
+			return
+		}
+		changed := c.changed
+		c.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// finish releases all waiting workers once the task queue is empty
+func (c *concurrencyController) finish() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.finished {
+		c.finished = true
+		c.broadcast()
+	}
+}
+
+// reportError records a failed attempt; rate limits and timeouts suggest the
+// hoster is throttling us
+func (c *concurrencyController) reportError(err error) {
+	if c == nil {
+		return
+	}
+	if class := errorClass(err); class == ClassRateLimited || class == ClassTimeout {
+		c.mutex.Lock()
+		c.throttled++
+		c.mutex.Unlock()
+	}
+}
+
+// run reconsiders the pool size every adaptInterval until the context is done
+func (c *concurrencyController) run(ctx context.Context, logger *ConsoleLogger) {
+	logger.SetWorkers(c.limit, "initial")
+	for sleepContext(ctx, adaptInterval) {
+		speed, active := logger.Throughput()
+		c.adjust(speed, active, logger)
+	}
+}
+
+// adjust shrinks the pool after throttling errors or when the last growth cut
+// the throughput per worker, and grows it while every worker stays busy and
+// the throughput per worker holds up. After an undone growth it waits a few
+// intervals before trying again, longer each time, so that the pool settles.
+func (c *concurrencyController) adjust(speed float64, active int, logger *ConsoleLogger) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	throttled := c.throttled
+	c.throttled = 0
+	perWorker := 0.0
+	if active > 0 {
+		perWorker = speed / float64(active)
+	}
+
+	limit, reason := c.limit, ""
+	switch {
+	case throttled > 0:
+		limit--
+		reason = fmt.Sprintf("%d rate limit or timeout %s", throttled, pluralize("error", throttled))
+	case active < c.limit:
+		// Not enough work to tell whether more workers would help
+		return
+	case c.baseline > 0 && perWorker < c.baseline*throughputDropRatio:
+		limit--
+		reason = fmt.Sprintf("throughput per worker fell from %s/s to %s/s",
+			formatBytes(int64(c.baseline)), formatBytes(int64(perWorker)))
+		c.baseline = 0
+		c.hold = c.backoff
+		c.backoff = min(c.backoff*2, maxGrowthHold)
+	case c.hold > 0:
+		c.hold--
+		return
+	case perWorker > 0:
+		if c.baseline > 0 {
+			// The last growth held up
+			c.backoff = growthHold
+		}
+		limit++
+		reason = fmt.Sprintf("throughput per worker holding at %s/s", formatBytes(int64(perWorker)))
+		c.baseline = perWorker
+	default:
+		return
+	}
+
+	limit = max(c.min, min(limit, c.max))
+	if limit == c.limit {
+		return
+	}
+
+	logger.Log("Workers: %d -> %d (%s)", c.limit, limit, reason)
+	logger.SetWorkers(limit, reason)
+	c.limit = limit
+	c.broadcast()
+}
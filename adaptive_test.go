@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestAdjustSettles(t *testing.T) {
+	// The hoster serves 1 MiB/s per connection up to two connections and
+	// throttles everything to 1 MiB/s in total beyond that
+	speedOf := func(workers int) float64 {
+		if workers <= 2 {
+			return float64(workers) * (1 << 20)
+		}
+		return 1 << 20
+	}
+
+	c := newConcurrencyController(Config{WorkerCount: 1, MinWorkers: 1, MaxWorkers: 8})
+	logger := NewConsoleLogger(1, 1, "test")
+	limits := make(map[int]int)
+	for interval := 0; interval < 60; interval++ {
+		c.adjust(speedOf(c.limit), c.limit, logger)
+		limits[c.limit]++
+	}
+
+	if c.limit != 2 {
+		t.Errorf("settled on %d workers, want 2", c.limit)
+	}
+	if limits[3] > 5 || limits[2] < 50 {
+		t.Errorf("intervals per pool size %v, want nearly all at 2", limits)
+	}
+	for size := range limits {
+		if size > 3 {
+			t.Errorf("grew to %d workers", size)
+		}
+	}
+}
+
+func TestAdjustShrinksOnThrottling(t *testing.T) {
+	c := newConcurrencyController(Config{WorkerCount: 4, MinWorkers: 2, MaxWorkers: 8})
+	logger := NewConsoleLogger(1, 1, "test")
+
+	tests := []struct {
+		throttled int
+		active    int
+		want      int
+	}{
+		{2, 4, 3},
+		{1, 3, 2},
+		// Never below --min-workers
+		{1, 2, 2},
+		// Idle workers say nothing about the hoster
+		{0, 1, 2},
+	}
+	for i, test := range tests {
+		for j := 0; j < test.throttled; j++ {
+			c.reportError(&DownloadError{Class: ClassRateLimited})
+		}
+		c.adjust(float64(test.active)*(1<<20), test.active, logger)
+		if c.limit != test.want {
+			t.Errorf("step %d: limit %d, want %d", i, c.limit, test.want)
+		}
+	}
+}
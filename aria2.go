@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// aria2PollInterval is how often a transfer handed to aria2 is polled
+	aria2PollInterval = 500 * time.Millisecond
+	// aria2RemovePollInterval is how often a removed transfer is checked until
+	// aria2 has stopped it
+	aria2RemovePollInterval = 100 * time.Millisecond
+)
+
+// aria2Client talks to a running aria2 daemon over JSON-RPC
+type aria2Client struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+// aria2Status is the part of aria2.tellStatus the downloader needs
+type aria2Status struct {
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+// aria2StatusKeys limits tellStatus to the fields of aria2Status
+var aria2StatusKeys = []string{"status", "totalLength", "completedLength", "errorCode", "errorMessage"}
+
+// NewAria2Client creates a client for the JSON-RPC endpoint, e.g.
+// http://localhost:6800/jsonrpc. secret is the --rpc-secret of the daemon.
+func NewAria2Client(endpoint, secret string, client *http.Client) *aria2Client {
+	return &aria2Client{endpoint: endpoint, secret: secret, client: client}
+}
+
+// call invokes an RPC method and decodes its result into result
+func (a *aria2Client) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if a.secret != "" {
+		params = append([]interface{}{"token:" + a.secret}, params...)
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "fuckingloader",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("aria2 request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("could not read aria2 response: %w", err)
+	}
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("invalid aria2 response (%s): %w", resp.Status, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("aria2 %s: %s (code %d)", method, reply.Error.Message, reply.Error.Code)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// Version returns the version of the daemon, which also checks that it is reachable
+func (a *aria2Client) Version(ctx context.Context) (string, error) {
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := a.call(ctx, "aria2.getVersion", &result); err != nil {
+		return "", err
+	}
+	return result.Version, nil
+}
+
+// AddURI queues a download and returns its GID
+func (a *aria2Client) AddURI(ctx context.Context, uri string, options map[string]string) (string, error) {
+	var gid string
+	err := a.call(ctx, "aria2.addUri", &gid, []string{uri}, options)
+	return gid, err
+}
+
+// TellStatus reports the state of a download
+func (a *aria2Client) TellStatus(ctx context.Context, gid string) (*aria2Status, error) {
+	var status aria2Status
+	if err := a.call(ctx, "aria2.tellStatus", &status, gid, aria2StatusKeys); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Remove stops a download and forgets it. aria2 keeps the partial file and
+// its control file, so adding the same file again continues the transfer.
+func (a *aria2Client) Remove(ctx context.Context, gid string) error {
+	if err := a.call(ctx, "aria2.forceRemove", nil, gid); err != nil {
+		return err
+	}
+
+	// aria2 stops the download asynchronously, and only the result of a
+	// stopped download can be dropped
+	for {
+		status, err := a.TellStatus(ctx, gid)
+		if err != nil {
+			return err
+		}
+		switch status.Status {
+		case "removed", "complete", "error":
+			return a.Forget(ctx, gid)
+		}
+		if !sleepContext(ctx, aria2RemovePollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// DownloadLimit returns the overall download limit of the daemon as it
+// reports it, in bytes per second
+func (a *aria2Client) DownloadLimit(ctx context.Context) (string, error) {
+	var options map[string]string
+	if err := a.call(ctx, "aria2.getGlobalOption", &options); err != nil {
+		return "", err
+	}
+	return options["max-overall-download-limit"], nil
+}
+
+// SetDownloadLimit changes the overall download limit of the daemon; "0" removes it
+func (a *aria2Client) SetDownloadLimit(ctx context.Context, limit string) error {
+	return a.call(ctx, "aria2.changeGlobalOption", nil, map[string]string{
+		"max-overall-download-limit": limit,
+	})
+}
+
+// aria2Error classifies a failed aria2 download by its exit status code
+func aria2Error(status *aria2Status) error {
+	err := fmt.Errorf("aria2 failed with code %s: %s", status.ErrorCode, status.ErrorMessage)
+	switch status.ErrorCode {
+	case "2":
+		return &DownloadError{Class: ClassTimeout, Err: err}
+	case "3":
+		return &DownloadError{Class: ClassFileRemoved, Err: err}
+	case "9":
+		return &DownloadError{Class: ClassDiskFull, Err: err}
+	}
+	return err
+}
+
+// syncAria2Limit keeps the daemon's overall limit in line with the limiter,
+// whose rate follows the schedule, until the context is cancelled. The limit
+// the daemon had before is restored then.
+func syncAria2Limit(ctx context.Context, aria2 *aria2Client, limiter *RateLimiter, logger *ConsoleLogger) {
+	if previous, err := aria2.DownloadLimit(ctx); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log("Could not read the aria2 rate limit, so it stays changed after the run: %v", err)
+	} else {
+		defer func() {
+			cleanup, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := aria2.SetDownloadLimit(cleanup, previous); err != nil {
+				logger.Log("Could not restore the aria2 rate limit: %v", err)
+			}
+		}()
+	}
+
+	applied := int64(-1)
+	for {
+		if rate := limiter.Rate(); rate != applied {
+			if err := aria2.SetDownloadLimit(ctx, strconv.FormatInt(rate, 10)); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Log("Could not set the aria2 rate limit: %v", err)
+			} else {
+				applied = rate
+			}
+		}
+		if !sleepContext(ctx, 30*time.Second) {
+			return
+		}
+	}
+}
+
+// Forget drops a finished download from the daemon's result list
+func (a *aria2Client) Forget(ctx context.Context, gid string) error {
+	return a.call(ctx, "aria2.removeDownloadResult", nil, gid)
+}
+
+// downloadWithAria2 resolves the direct file URL and lets the aria2 daemon
+// transfer it into the download directory, feeding its progress to the logger.
+// The daemon must see the download directory under the same path.
+func (d *Downloader) downloadWithAria2(ctx context.Context, hoster Hoster, link string, workerID int) error {
+	filename := extractFilenameFromURL(link)
+
+	d.logger.Log("[Worker %d] Resolving direct link for %s via %s", workerID, filename, hoster.Name())
+	resolved, err := hoster.Resolve(ctx, link, d.client)
+	if err != nil {
+		return err
+	}
+	d.noteOfferedName(filename, resolved.Filename, workerID)
+
+	dir, err := filepath.Abs(d.config.DownloadDir)
+	if err != nil {
+		return fmt.Errorf("could not resolve download directory: %w", err)
+	}
+	referer, _, _ := strings.Cut(link, "#")
+
+	options := map[string]string{
+		"dir":        dir,
+		"out":        filename,
+		"referer":    referer,
+		"user-agent": userAgent,
+		"continue":   "true",
+	}
+	if d.config.Segments > 1 {
+		// Let aria2 split the file like the built-in segmented download
+		options["split"] = strconv.Itoa(d.config.Segments)
+		options["max-connection-per-server"] = strconv.Itoa(min(d.config.Segments, 16))
+	}
+	gid, err := d.aria2.AddURI(ctx, resolved.URL, options)
+	if err != nil {
+		return err
+	}
+	d.logger.Log("[Worker %d] Handed %s to aria2 (gid %s)", workerID, filename, gid)
+
+	// Progress is reported as the difference to the last poll
+	started := false
+	var size, reported int64 = -1, 0
+	for {
+		if !sleepContext(ctx, aria2PollInterval) {
+			// Stop the transfer but leave its files for a later resume
+			cleanup, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			d.aria2.Remove(cleanup, gid)
+			cancel()
+			return ctx.Err()
+		}
+
+		status, err := d.aria2.TellStatus(ctx, gid)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+
+		total, _ := strconv.ParseInt(status.TotalLength, 10, 64)
+		completed, _ := strconv.ParseInt(status.CompletedLength, 10, 64)
+		if total <= 0 {
+			total = -1
+		}
+		if !started || total != size {
+			// Restart tracking once aria2 knows the size and the bytes it resumed from
+			d.logger.StartFile(workerID, filename, total, completed)
+			started, size, reported = true, total, completed
+		}
+		if completed > reported {
+			d.logger.AddBytes(workerID, completed-reported)
+			reported = completed
+		}
+
+		switch status.Status {
+		case "complete":
+			d.aria2.Forget(ctx, gid)
+			d.logger.Log("[Worker %d] Download completed: %s", workerID, filename)
+			return nil
+		case "error":
+			d.aria2.Forget(ctx, gid)
+			return aria2Error(status)
+		case "removed":
+			d.aria2.Forget(ctx, gid)
+			return fmt.Errorf("download was removed from aria2")
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// fakeRPCError is a JSON-RPC error returned by the fake daemon
+type fakeRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// fakeRPCCall is a request received by the fake daemon
+type fakeRPCCall struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// fakeAria2 is a JSON-RPC server standing in for the aria2 daemon. handle
+// answers every call with a result or an error.
+type fakeAria2 struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	calls  []fakeRPCCall
+	handle func(call fakeRPCCall) (interface{}, *fakeRPCError)
+}
+
+func newFakeAria2(t *testing.T, handle func(call fakeRPCCall) (interface{}, *fakeRPCError)) *fakeAria2 {
+	t.Helper()
+
+	fake := &fakeAria2{handle: handle}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     string            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid JSON-RPC request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call := fakeRPCCall{Method: request.Method, Params: request.Params}
+
+		fake.mutex.Lock()
+		fake.calls = append(fake.calls, call)
+		fake.mutex.Unlock()
+
+		result, rpcErr := fake.handle(call)
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		if rpcErr != nil {
+			reply["error"] = rpcErr
+		} else {
+			reply["result"] = result
+		}
+		json.NewEncoder(w).Encode(reply)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// methods lists the methods called so far, in order
+func (f *fakeAria2) methods() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	methods := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		methods[i] = call.Method
+	}
+	return methods
+}
+
+// call returns the first call of a method
+func (f *fakeAria2) call(method string) (fakeRPCCall, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, call := range f.calls {
+		if call.Method == method {
+			return call, true
+		}
+	}
+	return fakeRPCCall{}, false
+}
+
+// decodeParam decodes one parameter of a call
+func decodeParam(t *testing.T, call fakeRPCCall, index int, value interface{}) {
+	t.Helper()
+
+	if index >= len(call.Params) {
+		t.Fatalf("%s has %d params, want at least %d", call.Method, len(call.Params), index+1)
+	}
+	if err := json.Unmarshal(call.Params[index], value); err != nil {
+		t.Fatalf("param %d of %s: %v", index, call.Method, err)
+	}
+}
+
+// fakeHoster resolves every link to a fixed URL without the network
+type fakeHoster struct {
+	resolved ResolvedLink
+}
+
+func (h *fakeHoster) Name() string           { return "fake" }
+func (h *fakeHoster) Match(link string) bool { return strings.HasPrefix(link, "https://fake.test/") }
+
+func (h *fakeHoster) Resolve(ctx context.Context, link string, client *http.Client) (*ResolvedLink, error) {
+	resolved := h.resolved
+	return &resolved, nil
+}
+
+func (h *fakeHoster) BrowserDownload(ctx context.Context, page playwright.Page, link string, timeout float64,
+	logf func(format string, args ...interface{})) (playwright.Download, error) {
+	return nil, errors.New("browser download is not available in tests")
+}
+
+// newAria2Downloader creates a downloader that hands its transfers to the fake daemon
+func newAria2Downloader(t *testing.T, fake *fakeAria2, secret string) *Downloader {
+	t.Helper()
+
+	config := Config{DownloadDir: t.TempDir(), Aria2RPC: fake.URL, Aria2Secret: secret}
+	logger := NewConsoleLogger(1, 1, "test")
+	return NewDownloader(config, fake.Client(), nil, logger, nil, nil)
+}
+
+func TestAria2AddURIInjectsSecret(t *testing.T) {
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		return "2089b05ecca3d829", nil
+	})
+	aria2 := NewAria2Client(fake.URL, "s3cret", fake.Client())
+
+	gid, err := aria2.AddURI(context.Background(), "https://files.test/Game.part01.rar", map[string]string{"out": "Game.part01.rar"})
+	if err != nil {
+		t.Fatalf("AddURI: %v", err)
+	}
+	if gid != "2089b05ecca3d829" {
+		t.Errorf("gid = %q", gid)
+	}
+
+	call, _ := fake.call("aria2.addUri")
+	var token string
+	var uris []string
+	var options map[string]string
+	decodeParam(t, call, 0, &token)
+	decodeParam(t, call, 1, &uris)
+	decodeParam(t, call, 2, &options)
+	if token != "token:s3cret" {
+		t.Errorf("first param = %q, want the secret token", token)
+	}
+	if len(uris) != 1 || uris[0] != "https://files.test/Game.part01.rar" {
+		t.Errorf("uris = %v", uris)
+	}
+	if options["out"] != "Game.part01.rar" {
+		t.Errorf("options = %v", options)
+	}
+}
+
+func TestAria2WithoutSecret(t *testing.T) {
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		return map[string]string{"version": "1.37.0"}, nil
+	})
+	aria2 := NewAria2Client(fake.URL, "", fake.Client())
+
+	version, err := aria2.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if version != "1.37.0" {
+		t.Errorf("version = %q", version)
+	}
+	call, _ := fake.call("aria2.getVersion")
+	if call.Params == nil || len(call.Params) != 0 {
+		t.Errorf("params = %v, want an empty list", call.Params)
+	}
+}
+
+func TestAria2RPCError(t *testing.T) {
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		return nil, &fakeRPCError{Code: 1, Message: "Unauthorized"}
+	})
+	aria2 := NewAria2Client(fake.URL, "wrong", fake.Client())
+
+	_, err := aria2.AddURI(context.Background(), "https://files.test/file", nil)
+	if err == nil {
+		t.Fatal("AddURI succeeded despite an RPC error")
+	}
+	if want := "aria2 aria2.addUri: Unauthorized (code 1)"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestAria2ErrorClass(t *testing.T) {
+	tests := []struct {
+		code string
+		want ErrorClass
+	}{
+		{"2", ClassTimeout},
+		{"3", ClassFileRemoved},
+		{"9", ClassDiskFull},
+		{"1", ClassOther},
+	}
+	for _, test := range tests {
+		err := aria2Error(&aria2Status{Status: "error", ErrorCode: test.code, ErrorMessage: "failed"})
+		if got := errorClass(err); got != test.want {
+			t.Errorf("code %s: class %s, want %s", test.code, got, test.want)
+		}
+	}
+}
+
+func TestAria2RemoveWaitsUntilStopped(t *testing.T) {
+	var mutex sync.Mutex
+	polls := 0
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch call.Method {
+		case "aria2.forceRemove":
+			return "gid", nil
+		case "aria2.tellStatus":
+			// aria2 needs a moment to stop the download
+			polls++
+			if polls < 3 {
+				return aria2Status{Status: "active"}, nil
+			}
+			return aria2Status{Status: "removed"}, nil
+		case "aria2.removeDownloadResult":
+			if polls < 3 {
+				return nil, &fakeRPCError{Code: 1, Message: "Could not remove download result of GID#gid"}
+			}
+			return "OK", nil
+		}
+		return nil, &fakeRPCError{Code: 1, Message: "unexpected method " + call.Method}
+	})
+	aria2 := NewAria2Client(fake.URL, "", fake.Client())
+
+	if err := aria2.Remove(context.Background(), "gid"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	methods := fake.methods()
+	if methods[0] != "aria2.forceRemove" || methods[len(methods)-1] != "aria2.removeDownloadResult" {
+		t.Errorf("methods = %v", methods)
+	}
+	if polls != 3 {
+		t.Errorf("tellStatus was called %d times, want 3", polls)
+	}
+}
+
+func TestDownloadWithAria2PollsStatus(t *testing.T) {
+	statuses := []aria2Status{
+		{Status: "active", TotalLength: "0", CompletedLength: "0"},
+		{Status: "active", TotalLength: "100", CompletedLength: "40"},
+		{Status: "complete", TotalLength: "100", CompletedLength: "100"},
+	}
+	var mutex sync.Mutex
+	polls := 0
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch call.Method {
+		case "aria2.addUri":
+			return "gid", nil
+		case "aria2.tellStatus":
+			status := statuses[min(polls, len(statuses)-1)]
+			polls++
+			return status, nil
+		case "aria2.removeDownloadResult":
+			return "OK", nil
+		}
+		return nil, &fakeRPCError{Code: 1, Message: "unexpected method " + call.Method}
+	})
+	d := newAria2Downloader(t, fake, "s3cret")
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: "https://files.test/direct", Filename: "renamed-by-hoster.rar", Size: -1}}
+
+	if err := d.downloadWithAria2(context.Background(), hoster, "https://fake.test/abc#Game.part01.rar", 1); err != nil {
+		t.Fatalf("downloadWithAria2: %v", err)
+	}
+	if polls != len(statuses) {
+		t.Errorf("tellStatus was called %d times, want %d", polls, len(statuses))
+	}
+	if d.logger.receivedBytes != 100 {
+		t.Errorf("logger received %d bytes, want 100", d.logger.receivedBytes)
+	}
+
+	call, _ := fake.call("aria2.addUri")
+	var token string
+	var options map[string]string
+	decodeParam(t, call, 0, &token)
+	decodeParam(t, call, 2, &options)
+	if token != "token:s3cret" {
+		t.Errorf("first param = %q, want the secret token", token)
+	}
+	if options["out"] != "Game.part01.rar" || options["referer"] != "https://fake.test/abc" {
+		t.Errorf("options = %v", options)
+	}
+
+	status, _ := fake.call("aria2.tellStatus")
+	var tellToken, gid string
+	decodeParam(t, status, 0, &tellToken)
+	decodeParam(t, status, 1, &gid)
+	if tellToken != "token:s3cret" || gid != "gid" {
+		t.Errorf("tellStatus params = %s", status.Params)
+	}
+	if methods := fake.methods(); methods[len(methods)-1] != "aria2.removeDownloadResult" {
+		t.Errorf("finished download was not forgotten: %v", methods)
+	}
+}
+
+func TestDownloadWithAria2Failure(t *testing.T) {
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		switch call.Method {
+		case "aria2.addUri":
+			return "gid", nil
+		case "aria2.tellStatus":
+			return aria2Status{Status: "error", ErrorCode: "3", ErrorMessage: "Resource was not found"}, nil
+		}
+		return "OK", nil
+	})
+	d := newAria2Downloader(t, fake, "")
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: "https://files.test/direct", Size: -1}}
+
+	err := d.downloadWithAria2(context.Background(), hoster, "https://fake.test/abc#Game.part01.rar", 1)
+	if class := errorClass(err); class != ClassFileRemoved {
+		t.Errorf("class = %s (%v), want %s", class, err, ClassFileRemoved)
+	}
+}
+
+func TestFetchWithAria2DoesNotFallBackToBrowser(t *testing.T) {
+	useHoster(t, &fakeHoster{resolved: ResolvedLink{URL: "https://files.test/direct", Size: -1}})
+
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		return nil, &fakeRPCError{Code: 1, Message: "Unauthorized"}
+	})
+	d := newAria2Downloader(t, fake, "")
+
+	// Without a browser session a fallback would fail differently or panic
+	err := d.fetch(context.Background(), "https://fake.test/abc#Game.part01.rar", 1)
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("fetch = %v, want the aria2 error", err)
+	}
+}
+
+func TestSyncAria2LimitRestoresPreviousLimit(t *testing.T) {
+	applied := make(chan string, 4)
+	fake := newFakeAria2(t, func(call fakeRPCCall) (interface{}, *fakeRPCError) {
+		switch call.Method {
+		case "aria2.getGlobalOption":
+			return map[string]string{"max-overall-download-limit": "1048576", "max-concurrent-downloads": "5"}, nil
+		case "aria2.changeGlobalOption":
+			var options map[string]string
+			decodeParam(t, call, 1, &options)
+			applied <- options["max-overall-download-limit"]
+		}
+		return "OK", nil
+	})
+	aria2 := NewAria2Client(fake.URL, "s3cret", fake.Client())
+	limiter, err := NewRateLimiter("500K", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		syncAria2Limit(ctx, aria2, limiter, NewConsoleLogger(1, 1, "test"))
+	}()
+
+	if limit := <-applied; limit != "512000" {
+		t.Errorf("applied limit %q, want 512000", limit)
+	}
+	cancel()
+	<-done
+	select {
+	case limit := <-applied:
+		if limit != "1048576" {
+			t.Errorf("restored limit %q, want 1048576", limit)
+		}
+	default:
+		t.Error("the previous limit was not restored")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// invalidDirChars are replaced when a game title becomes a directory name
+var invalidDirChars = strings.NewReplacer(
+	"<", "", ">", "", ":", " -", "\"", "", "/", "-", "\\", "-", "|", "-", "?", "", "*", "",
+)
+
+// newSourceJob groups the links of one source, lets the user select what to
+// download and saves the job state. In batch mode the files go to a
+// subdirectory of config.DownloadDir named after the game; usedDirs keeps
+// those names unique. Returns nil if nothing was selected.
+func newSourceJob(config Config, sourceURL string, links []string, release *ReleaseInfo, batch bool, usedDirs map[string]bool) (*Job, error) {
+	groups := selectGroups(config, links, release)
+	if groups == nil {
+		return nil, nil
+	}
+
+	name := ""
+	if batch {
+		name = uniqueDirName(gameName(release, groups, sourceURL), usedDirs)
+		config.DownloadDir = filepath.Join(config.DownloadDir, name)
+	}
+	if err := os.MkdirAll(config.DownloadDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	// Remember the selection so an interrupted run can be resumed
+	state := NewJobState(config.DownloadDir, sourceURL, groups)
+	state.Release = release
+	if len(state.Files) == 0 {
+		return nil, nil
+	}
+	if previous, err := LoadJobState(config.DownloadDir); err == nil {
+		state.inheritSizes(previous)
+	}
+	if err := state.Save(); err != nil {
+		return nil, err
+	}
+
+	return NewJob(name, config, state), nil
+}
+
+// selectGroups groups the links by their base names and lets the user select
+// which groups to download. Returns nil if the user cancelled.
+func selectGroups(config Config, links []string, release *ReleaseInfo) []FileGroup {
+	log.Printf("Found %d links to download", len(links))
+
+	// Group the links by their base names
+	groups := groupDownloadLinks(links)
+	log.Printf("Organized into %d distinct file groups", len(groups))
+	reportMissingVolumes(groups)
+
+	// Groups listed on the command line need no menu
+	if config.Groups != "" {
+		found, err := selectGroupIDs(groups, config.Groups)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !found {
+			return nil
+		}
+	} else if len(config.Include) == 0 {
+		// Language packs for other languages start out deselected, unless
+		// include patterns name the groups to download
+		applyLanguagePreference(groups, config.Language)
+	}
+
+	// Neither do groups chosen by patterns
+	patterns := len(config.Include) > 0 || len(config.Exclude) > 0
+	if patterns {
+		if err := applyPatterns(groups, config.Include, config.Exclude); err != nil {
+			log.Fatal(err)
+		}
+		if !anySelected(groups) {
+			log.Printf("No group matches --include and --exclude")
+			return nil
+		}
+	}
+
+	// Allow user to select which groups to download (unless skipped)
+	if config.Groups == "" && !patterns && !config.SkipSelection {
+		return interactiveSelection(config, groups, release)
+	}
+	return groups
+}
+
+// anySelected reports whether at least one group is selected
+func anySelected(groups []FileGroup) bool {
+	for _, group := range groups {
+		if group.Selected {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBatch resolves every start URL into a job of its own. A source that
+// cannot be resolved is reported in the summary instead of stopping the batch.
+func resolveBatch(ctx context.Context, config Config, session *BrowserSession, sources []string) []*Job {
+	var jobs []*Job
+	usedDirs := make(map[string]bool)
+	for i, source := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("[%d/%d] Resolving %s", i+1, len(sources), source)
+
+		links, release, err := resolveLinks(ctx, source, config, session)
+		if err == nil {
+			var job *Job
+			if job, err = newSourceJob(config, source, links, release, true, usedDirs); job != nil {
+				jobs = append(jobs, job)
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to resolve %s: %v", source, err)
+			jobs = append(jobs, &Job{Name: source, err: err})
+		} else {
+			log.Printf("Nothing selected from %s", source)
+		}
+	}
+	return jobs
+}
+
+// loadJobs finds the saved jobs of a download directory: the directory's own
+// state file, or else one per subdirectory as written by a batch run
+func loadJobs(config Config) ([]*Job, error) {
+	state, err := LoadJobState(config.DownloadDir)
+	if err == nil {
+		return []*Job{NewJob("", config, state)}, nil
+	}
+
+	entries, readErr := os.ReadDir(config.DownloadDir)
+	if readErr != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(config.DownloadDir, entry.Name())
+		if _, statErr := os.Stat(filepath.Join(dir, stateFileName)); statErr != nil {
+			continue
+		}
+
+		subState, loadErr := LoadJobState(dir)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		jobConfig := config
+		jobConfig.DownloadDir = dir
+		jobs = append(jobs, NewJob(entry.Name(), jobConfig, subState))
+	}
+
+	if len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// gameName picks a name for a game's download directory: the release title,
+// else the base name shared by the archive parts, else the paste ID
+func gameName(release *ReleaseInfo, groups []FileGroup, sourceURL string) string {
+	if release != nil && release.Title != "" {
+		return release.Title
+	}
+
+	for _, group := range groups {
+		// setup.exe says nothing about the game
+		if !group.Selected || group.Category == CategoryInstaller {
+			continue
+		}
+		// FitGirl names parts like Game_Name_--_fitgirl-repacks.site_--_.part01.rar
+		name := group.Name
+		if i := strings.Index(name, "_--_"); i > 0 {
+			name = name[:i]
+		}
+		name = strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
+		if name != "" {
+			return name
+		}
+	}
+
+	if u, err := url.Parse(sourceURL); err == nil {
+		if id := strings.Trim(u.RawQuery, "/"); id != "" {
+			return "paste-" + id
+		}
+		if id := strings.Trim(u.Path, "/"); id != "" {
+			return id
+		}
+	}
+	return "download"
+}
+
+// uniqueDirName makes a game name safe as a directory name and distinct from
+// the names already used in this batch
+func uniqueDirName(name string, used map[string]bool) string {
+	name = strings.Trim(invalidDirChars.Replace(name), " .")
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		name = "download"
+	}
+
+	unique := name
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
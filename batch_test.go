@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestGameName(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://fuckingfast.co/a#God_of_War_--_fitgirl-repacks.site_--_.part01.rar", "God of War"},
+		{"https://fuckingfast.co/a#Mixed_Case_Game_--_fitgirl-repacks.site_--_fg-01.bin", "Mixed Case Game"},
+		{"https://fuckingfast.co/a#Some.Game.part01.rar", "Some.Game"},
+		{"https://fuckingfast.co/a#Tool.exe", "Tool"},
+	}
+	for _, test := range tests {
+		groups := groupDownloadLinks([]string{test.link})
+		if got := gameName(nil, groups, "https://paste.fitgirl-repacks.site/?abc"); got != test.want {
+			t.Errorf("gameName(%s) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// BrowserSession starts Playwright and Chromium on first use so that runs which
+// never need a browser do not require Playwright to be installed
+type BrowserSession struct {
+	headless bool
+	once     sync.Once
+	pw       *playwright.Playwright
+	browser  playwright.Browser
+	err      error
+}
+
+// NewBrowserSession creates a session; nothing is started until Browser is called
+func NewBrowserSession(headless bool) *BrowserSession {
+	return &BrowserSession{headless: headless}
+}
+
+// Browser returns the shared browser, installing and launching it if needed
+func (bs *BrowserSession) Browser() (playwright.Browser, error) {
+	bs.once.Do(func() {
+		// Install Playwright if needed
+		if err := playwright.Install(); err != nil {
+			bs.err = fmt.Errorf("failed to install Playwright driver: %w", err)
+			return
+		}
+
+		// Start Playwright and launch the browser
+		pw, err := playwright.Run()
+		if err != nil {
+			bs.err = fmt.Errorf("could not start Playwright: %w", err)
+			return
+		}
+
+		browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+			Headless: playwright.Bool(bs.headless),
+		})
+		if err != nil {
+			pw.Stop()
+			bs.err = fmt.Errorf("could not launch browser: %w", err)
+			return
+		}
+
+		bs.pw = pw
+		bs.browser = browser
+	})
+
+	return bs.browser, bs.err
+}
+
+// Close shuts down the browser and Playwright if they were started
+func (bs *BrowserSession) Close() {
+	// Make sure a concurrent first call cannot start the browser after closing
+	bs.once.Do(func() {})
+
+	if bs.browser != nil {
+		if err := bs.browser.Close(); err != nil {
+			log.Printf("Could not close browser: %v", err)
+		}
+	}
+	if bs.pw != nil {
+		if err := bs.pw.Stop(); err != nil {
+			log.Printf("Could not stop Playwright: %v", err)
+		}
+	}
+}
+
+// closeOnCancel closes the page when the context is cancelled so that pending
+// Playwright calls return right away. The returned function stops watching.
+func closeOnCancel(ctx context.Context, page playwright.Page) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			page.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
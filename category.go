@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GroupCategory tells which part of a FitGirl release a file group holds
+type GroupCategory string
+
+const (
+	// CategoryCore is the game itself: the numbered .bin files or RAR parts
+	CategoryCore GroupCategory = "core"
+	// CategorySelective is a language pack that only one language needs
+	CategorySelective GroupCategory = "selective"
+	// CategoryOptional is bonus content such as soundtracks or artbooks
+	CategoryOptional GroupCategory = "optional"
+	// CategoryInstaller is setup.exe, needed to install from the .bin files
+	CategoryInstaller GroupCategory = "installer"
+	// CategoryOther is any file that does not follow FitGirl's naming
+	CategoryOther GroupCategory = ""
+)
+
+// siteMarker separates the game title from the file name in mirror uploads,
+// as in Game_Title_--_fitgirl-repacks.site_--_fg-01.bin
+const siteMarker = "fitgirl-repacks.site_--_"
+
+var (
+	// selectiveRegex matches a language pack such as fg-selective-english.bin
+	selectiveRegex = regexp.MustCompile(`(?:^|[_.-])(?:fg|fitgirl)-selective-([a-z0-9-]+)`)
+	// optionalRegex matches bonus content such as fg-optional-bonus-ost.bin
+	optionalRegex = regexp.MustCompile(`(?:^|[_.-])(?:fg|fitgirl)-optional-`)
+	// installerRegex matches the installer of a release
+	installerRegex = regexp.MustCompile(`(?:^|[_.-])setup\.exe$`)
+)
+
+// categorize classifies a lowercase filename. archivePart tells whether the
+// file is a numbered volume, such as a RAR part or fg-01.bin, which counts as
+// core unless its name says otherwise. For language packs the language is
+// returned as well.
+func categorize(filename string, archivePart bool) (GroupCategory, string) {
+	switch {
+	case installerRegex.MatchString(filename):
+		return CategoryInstaller, ""
+	case selectiveRegex.MatchString(filename):
+		return CategorySelective, strings.Trim(selectiveRegex.FindStringSubmatch(filename)[1], "-")
+	case optionalRegex.MatchString(filename):
+		return CategoryOptional, ""
+	case archivePart:
+		return CategoryCore, ""
+	}
+	return CategoryOther, ""
+}
+
+// categoryLabel describes the group's category in the selection menus; empty
+// for files outside FitGirl's naming
+func (g *FileGroup) categoryLabel() string {
+	switch g.Category {
+	case CategoryCore:
+		return "Core"
+	case CategorySelective:
+		return "Language pack (" + g.Language + ")"
+	case CategoryOptional:
+		return "Optional"
+	case CategoryInstaller:
+		return "Installer"
+	}
+	return ""
+}
+
+// shortName is the group's name without the game title and site marker that
+// FitGirl's mirrors put in front of every file name, when something remains
+// without them
+func (g *FileGroup) shortName() string {
+	if i := strings.LastIndex(strings.ToLower(g.Name), siteMarker); i >= 0 {
+		if short := strings.Trim(g.Name[i+len(siteMarker):], "_-. "); short != "" {
+			return short
+		}
+	}
+	return g.Name
+}
+
+// menuLabel is the group's short name with its category, as listed in the menus
+func (g *FileGroup) menuLabel() string {
+	name := g.shortName()
+	if len(g.Missing) > 0 {
+		name += fmt.Sprintf(" [incomplete: %d missing]", len(g.Missing))
+	}
+	if label := g.categoryLabel(); label != "" {
+		return label + ": " + name
+	}
+	return name
+}
+
+// applyLanguagePreference deselects the language packs of languages other than
+// the comma-separated preferred ones. A pack matches a language by its name or
+// a variant of it, so "spanish" also keeps "spanish-latam". An empty
+// preference keeps every pack.
+func applyLanguagePreference(groups []FileGroup, preferred string) {
+	var languages []string
+	for _, language := range strings.Split(preferred, ",") {
+		if language = strings.ToLower(strings.TrimSpace(language)); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	if len(languages) == 0 {
+		return
+	}
+
+	for i := range groups {
+		if groups[i].Category != CategorySelective {
+			continue
+		}
+		groups[i].Selected = false
+		for _, language := range languages {
+			if groups[i].Language == language || strings.HasPrefix(groups[i].Language, language+"-") {
+				groups[i].Selected = true
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		filename    string
+		archivePart bool
+		category    GroupCategory
+		language    string
+	}{
+		{"game_--_fitgirl-repacks.site_--_fg-01.bin", true, CategoryCore, ""},
+		{"game.part001.rar", true, CategoryCore, ""},
+		{"game_--_fitgirl-repacks.site_--_fg-selective-english.bin", false, CategorySelective, "english"},
+		{"fg-selective-spanish-latam.bin", false, CategorySelective, "spanish-latam"},
+		{"fitgirl-selective-japanese-01.bin", true, CategorySelective, "japanese-01"},
+		{"game_--_fitgirl-repacks.site_--_fg-optional-bonus-ost.bin", false, CategoryOptional, ""},
+		{"game_--_fitgirl-repacks.site_--_setup.exe", false, CategoryInstaller, ""},
+		{"mysetup.exe", false, CategoryOther, ""},
+		{"readme.txt", false, CategoryOther, ""},
+		{"notfg-optional-ost.bin", false, CategoryOther, ""},
+	}
+	for _, test := range tests {
+		category, language := categorize(test.filename, test.archivePart)
+		if category != test.category || language != test.language {
+			t.Errorf("categorize(%q) = %q, %q; want %q, %q", test.filename, category, language, test.category, test.language)
+		}
+	}
+}
+
+func TestMenuLabel(t *testing.T) {
+	tests := []struct {
+		group FileGroup
+		want  string
+	}{
+		{FileGroup{Name: "Game_--_fitgirl-repacks.site_--_fg", Category: CategoryCore}, "Core: fg"},
+		{FileGroup{Name: "Game_--_fitgirl-repacks.site_--_fg-selective-french", Category: CategorySelective, Language: "french"},
+			"Language pack (french): fg-selective-french"},
+		{FileGroup{Name: "Game.part", Category: CategoryCore, Missing: []string{"Game.part03.rar"}}, "Core: Game.part [incomplete: 1 missing]"},
+		{FileGroup{Name: "Game_--_fitgirl-repacks.site_--_"}, "Game_--_fitgirl-repacks.site_--_"},
+		{FileGroup{Name: "readme"}, "readme"},
+	}
+	for _, test := range tests {
+		if got := test.group.menuLabel(); got != test.want {
+			t.Errorf("menuLabel of %q = %q, want %q", test.group.Name, got, test.want)
+		}
+	}
+}
+
+func TestApplyLanguagePreference(t *testing.T) {
+	tests := []struct {
+		preferred string
+		want      []string
+	}{
+		{"english", []string{"core", "english"}},
+		{"Spanish, french", []string{"core", "french", "spanish-latam"}},
+		{"", []string{"core", "english", "french", "spanish-latam"}},
+	}
+	for _, test := range tests {
+		groups := []FileGroup{
+			{ID: "core", Category: CategoryCore, Selected: true},
+			{ID: "english", Category: CategorySelective, Language: "english", Selected: true},
+			{ID: "french", Category: CategorySelective, Language: "french", Selected: true},
+			{ID: "spanish-latam", Category: CategorySelective, Language: "spanish-latam", Selected: true},
+		}
+		applyLanguagePreference(groups, test.preferred)
+		if got := selectedIDs(groups); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("preference %q selected %v, want %v", test.preferred, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Values of --space-check
+const (
+	spaceCheckWarn   = "warn"
+	spaceCheckRefuse = "refuse"
+	spaceCheckOff    = "off"
+)
+
+// spacePollInterval is how often paused workers look at the free space again
+const spacePollInterval = 15 * time.Second
+
+// estimateSizes fills in the size of every task's file: the total recorded
+// for its partial download, or else, when probe is set, the size announced
+// for its first supported source. Sizes that stay unknown are -1. Files are
+// probed config.WorkerCount at a time.
+func estimateSizes(ctx context.Context, config Config, client *http.Client, tasks []downloadTask, probe bool) {
+	if probe && len(tasks) > 0 {
+		log.Printf("Estimating the size of %d %s...", len(tasks), pluralize("file", len(tasks)))
+	}
+	forEachConcurrently(ctx, config.WorkerCount, len(tasks), func(i int) {
+		task := &tasks[i]
+		task.size = -1
+		if state := task.partial(); state != nil && state.TotalSize > 0 {
+			task.size = state.TotalSize
+		} else if probe {
+			task.size = remoteSize(ctx, client, task.job.state.Sources(task.link))
+		}
+	})
+}
+
+// checkDiskSpace compares how much the pending files still need with the free
+// space of the download directory, keeping minFree bytes in reserve. A
+// shortfall is logged, or returned as an error with --space-check=refuse.
+func checkDiskSpace(config Config, tasks []downloadTask, minFree int64) error {
+	if config.SpaceCheck == spaceCheckOff || len(tasks) == 0 {
+		return nil
+	}
+	free, err := freeSpace(config.DownloadDir)
+	if err != nil {
+		log.Printf("Could not determine free disk space: %v", err)
+		return nil
+	}
+
+	needed, unknown := estimateRemaining(tasks)
+	log.Printf("Still to download: %s; free in %s: %s", formatBytes(needed), config.DownloadDir, formatBytes(free))
+	if unknown > 0 {
+		log.Printf("The size of %d %s could not be determined", unknown, pluralize("file", unknown))
+	}
+	if needed+minFree <= free {
+		return nil
+	}
+
+	err = fmt.Errorf("not enough disk space in %s: %s needed plus %s reserve, but only %s free",
+		config.DownloadDir, formatBytes(needed), formatBytes(minFree), formatBytes(free))
+	if config.SpaceCheck == spaceCheckRefuse {
+		return err
+	}
+	log.Printf("Warning: %v", err)
+	return nil
+}
+
+// estimateRemaining adds up the bytes still missing from the tasks' files,
+// less what their partial downloads already hold. Files whose size is unknown
+// are counted separately.
+func estimateRemaining(tasks []downloadTask) (needed int64, unknown int) {
+	for i := range tasks {
+		if tasks[i].size < 0 {
+			unknown++
+			continue
+		}
+		remaining := tasks[i].size
+		if state := tasks[i].partial(); state != nil {
+			remaining -= state.BytesWritten
+		}
+		needed += max(remaining, 0)
+	}
+	return needed, unknown
+}
+
+// remoteSize returns the size announced for the first supported source, or
+// -1 when it is unknown
+func remoteSize(ctx context.Context, client *http.Client, sources []string) int64 {
+	for _, source := range sources {
+		if _, err := hosterFor(source); err != nil {
+			continue
+		}
+		size, err := probeRemoteSize(ctx, source, client)
+		if err != nil {
+			return -1
+		}
+		return size
+	}
+	return -1
+}
+
+// spaceMonitor holds back new downloads while the free space of the download
+// directory is below --min-free. A nil monitor never waits.
+type spaceMonitor struct {
+	dir     string
+	minFree int64
+	mutex   sync.Mutex
+	paused  bool
+}
+
+// newSpaceMonitor returns nil when no reserve is configured or the free space
+// cannot be determined on this platform
+func newSpaceMonitor(config Config) *spaceMonitor {
+	minFree, err := parseSize(config.MinFree)
+	if err != nil || minFree == 0 {
+		return nil
+	}
+	if _, err := freeSpace(config.DownloadDir); err != nil {
+		return nil
+	}
+	return &spaceMonitor{dir: config.DownloadDir, minFree: minFree}
+}
+
+// wait blocks while the free space is below the reserve. It returns once
+// enough space is free again or the context is done.
+func (m *spaceMonitor) wait(ctx context.Context, logger *ConsoleLogger) {
+	if m == nil {
+		return
+	}
+	for {
+		free, err := freeSpace(m.dir)
+		low := err == nil && free < m.minFree
+
+		// Only the worker that notices the change reports it
+		m.mutex.Lock()
+		if low != m.paused {
+			m.paused = low
+			if low {
+				logger.Log("Low disk space: %s free, below %s; pausing new downloads",
+					formatBytes(free), formatBytes(m.minFree))
+				logger.SetPaused("low disk space")
+			} else {
+				logger.Log("Disk space available again (%s free); resuming downloads", formatBytes(free))
+				logger.SetPaused("")
+			}
+		}
+		m.mutex.Unlock()
+
+		if !low || !sleepContext(ctx, spacePollInterval) {
+			return
+		}
+	}
+}
+
+// validateSpaceFlags checks --space-check and returns the --min-free reserve in bytes
+func validateSpaceFlags(config Config) (int64, error) {
+	switch config.SpaceCheck {
+	case spaceCheckWarn, spaceCheckRefuse, spaceCheckOff:
+	default:
+		return 0, errors.New("--space-check must be warn, refuse or off")
+	}
+	minFree, err := parseSize(config.MinFree)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --min-free: %w", err)
+	}
+	return minFree, nil
+}
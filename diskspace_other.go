@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// diskFullErrors are the errors of writing to a full disk
+var diskFullErrors = []error{syscall.ENOSPC}
+
+// freeSpace is not available on this platform, so disk checks are skipped
+func freeSpace(path string) (int64, error) {
+	return 0, errors.New("free space cannot be determined on this platform")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSpaceFlags(t *testing.T) {
+	tests := []struct {
+		spaceCheck, minFree string
+		want                int64
+		valid               bool
+	}{
+		{"warn", "1G", 1 << 30, true},
+		{"refuse", "512M", 512 << 20, true},
+		{"off", "0", 0, true},
+		{"warn", "", 0, false},
+		{"always", "1G", 0, false},
+		{"warn", "lots", 0, false},
+		{"warn", "0.1B", 0, false},
+	}
+	for _, test := range tests {
+		minFree, err := validateSpaceFlags(Config{SpaceCheck: test.spaceCheck, MinFree: test.minFree})
+		if (err == nil) != test.valid || minFree != test.want {
+			t.Errorf("validateSpaceFlags(%q, %q) = %d, %v; want %d, valid %v",
+				test.spaceCheck, test.minFree, minFree, err, test.want, test.valid)
+		}
+	}
+}
+
+func TestEstimateRemaining(t *testing.T) {
+	useHoster(t, &probeHoster{size: 1000})
+	dir := t.TempDir()
+	links := []string{
+		"https://fake.test/a#fresh.bin",
+		"https://fake.test/b#resumed.bin",
+		"https://elsewhere.test/c#unsupported.bin",
+	}
+	job := &Job{config: Config{DownloadDir: dir}, state: testJobState(dir, links)}
+
+	// The interrupted file records its own size, which wins over the hoster's
+	partial := &partialState{SourceURL: links[1], TotalSize: 400, BytesWritten: 150}
+	if err := partial.save(filepath.Join(dir, "resumed.bin"+sidecarSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		probe   bool
+		sizes   []int64
+		needed  int64
+		unknown int
+	}{
+		{"probed", true, []int64{1000, 400, -1}, 1000 + 250, 1},
+		{"partial files only", false, []int64{-1, 400, -1}, 250, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks := make([]downloadTask, len(links))
+			for i, link := range links {
+				tasks[i] = downloadTask{link: link, job: job}
+			}
+			estimateSizes(context.Background(), Config{WorkerCount: 2}, http.DefaultClient, tasks, test.probe)
+
+			for i, task := range tasks {
+				if task.size != test.sizes[i] {
+					t.Errorf("size of %s = %d, want %d", task.link, task.size, test.sizes[i])
+				}
+			}
+			needed, unknown := estimateRemaining(tasks)
+			if needed != test.needed || unknown != test.unknown {
+				t.Errorf("estimateRemaining = %d, %d unknown; want %d, %d unknown", needed, unknown, test.needed, test.unknown)
+			}
+		})
+	}
+}
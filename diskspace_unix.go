@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskFullErrors are the errnos of writing to a full disk or exceeding a quota
+var diskFullErrors = []error{syscall.ENOSPC, syscall.EDQUOT}
+
+// freeSpace returns the bytes available to this user on the filesystem of path
+func freeSpace(path string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
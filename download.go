@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// userAgent is sent with every plain HTTP request; hosters reject Go's default one
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// newHTTPClient creates a client for page requests and file transfers. Only
+// connection setup and response headers are bounded by the timeout, so long
+// transfers are not cut off.
+func newHTTPClient(config Config) *http.Client {
+	timeout := time.Duration(config.Timeout) * time.Second
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   timeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// Downloader fetches files, preferring plain HTTP over the browser
+type Downloader struct {
+	config    Config
+	client    *http.Client
+	session   *BrowserSession
+	logger    *ConsoleLogger
+	checksums ChecksumManifest
+	// aria2 takes over the transfers when set
+	aria2 *aria2Client
+	// limiter caps the throughput shared by all workers; nil when unlimited
+	limiter *RateLimiter
+}
+
+// NewDownloader creates a downloader sharing one HTTP client across workers
+func NewDownloader(config Config, client *http.Client, session *BrowserSession, logger *ConsoleLogger, checksums ChecksumManifest, limiter *RateLimiter) *Downloader {
+	downloader := &Downloader{
+		config:    config,
+		client:    client,
+		session:   session,
+		logger:    logger,
+		checksums: checksums,
+		limiter:   limiter,
+	}
+	if config.Aria2RPC != "" {
+		downloader.aria2 = NewAria2Client(config.Aria2RPC, config.Aria2Secret, client)
+	}
+	return downloader
+}
+
+// Download downloads a single link, trying the hoster's direct HTTP resolver
+// first and falling back to driving a browser page when it fails. Cancelling the
+// context aborts the transfer, keeping the partial file for a later resume.
+// The returned error is classified so that the caller can pick a retry policy.
+func (d *Downloader) Download(ctx context.Context, link string, workerID int) error {
+	err := d.fetch(ctx, link, workerID)
+	if err == nil {
+		err = d.verify(link, workerID)
+	}
+	d.logger.FinishFile(workerID, err == nil)
+	return err
+}
+
+// fetch transfers the file through aria2 when it is configured, otherwise
+// using the direct resolver and falling back to the browser
+func (d *Downloader) fetch(ctx context.Context, link string, workerID int) error {
+	hoster, err := hosterFor(link)
+	if err != nil {
+		d.logger.Log("[Worker %d] %v", workerID, err)
+		return err
+	}
+
+	if d.aria2 != nil {
+		err = d.downloadWithAria2(ctx, hoster, link, workerID)
+	} else {
+		err = d.downloadDirect(ctx, hoster, link, workerID)
+	}
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		d.logger.Log("[Worker %d] Download of %s interrupted", workerID, extractFilenameFromURL(link))
+		return ctx.Err()
+	}
+
+	// A file handed to aria2 stays with aria2; the retry goes through it again
+	if d.aria2 != nil {
+		d.logger.Log("[Worker %d] aria2 download failed: %v", workerID, err)
+		return err
+	}
+
+	// A segment that stopped early is resumed with the others on the next attempt
+	var segErr *segmentError
+	if errors.As(err, &segErr) {
+		d.logger.Log("[Worker %d] Direct download failed: %v", workerID, err)
+		return err
+	}
+
+	// The browser cannot help with a file that is gone or a disk that is full,
+	// and a rate limit is better waited out than hit again from the browser
+	if class := errorClass(err); class == ClassFileRemoved || class == ClassDiskFull || class == ClassRateLimited {
+		d.logger.Log("[Worker %d] Direct download failed (%s): %v", workerID, class, err)
+		return err
+	}
+	d.logger.Log("[Worker %d] Direct download failed: %v; falling back to browser", workerID, err)
+
+	if err := d.downloadWithBrowser(ctx, hoster, link, workerID); err != nil {
+		d.logger.Log("[Worker %d] %v", workerID, err)
+		return err
+	}
+	return nil
+}
+
+// noteOfferedName logs when the hoster offers a file under another name than
+// the one in its link. Files are always saved under the link's name, since
+// verification, resume, extraction and the job state look them up by it.
+func (d *Downloader) noteOfferedName(filename, offered string, workerID int) {
+	if offered != "" && offered != filename {
+		d.logger.Log("[Worker %d] %s is served as %s; saving it under the link's name", workerID, filename, offered)
+	}
+}
+
+// verify checks a finished file against the checksum manifest. A mismatched
+// file is deleted so that the retry downloads it again from scratch.
+func (d *Downloader) verify(link string, workerID int) error {
+	filename := extractFilenameFromURL(link)
+	path := filepath.Join(d.config.DownloadDir, filename)
+
+	ok, known, err := d.checksums.Verify(path)
+	if !known {
+		return nil
+	}
+	if err != nil {
+		d.logger.Log("[Worker %d] Could not verify %s: %v", workerID, filename, err)
+		return fmt.Errorf("could not verify %s: %w", filename, err)
+	}
+	if !ok {
+		d.logger.Log("[Worker %d] Checksum mismatch for %s; re-downloading", workerID, filename)
+		os.Remove(path)
+		return &DownloadError{Class: ClassChecksumMismatch, Err: fmt.Errorf("checksum mismatch for %s", filename)}
+	}
+
+	d.logger.Log("[Worker %d] Checksum OK: %s", workerID, filename)
+	return nil
+}
+
+// downloadDirect resolves the direct file URL without a browser and streams the
+// file into a .part file, continuing an earlier partial download when possible
+func (d *Downloader) downloadDirect(ctx context.Context, hoster Hoster, link string, workerID int) error {
+	filename := extractFilenameFromURL(link)
+
+	d.logger.Log("[Worker %d] Resolving direct link for %s via %s", workerID, filename, hoster.Name())
+	resolved, err := hoster.Resolve(ctx, link, d.client)
+	if err != nil {
+		return err
+	}
+	directURL := resolved.URL
+	d.noteOfferedName(filename, resolved.Filename, workerID)
+
+	downloadPath := filepath.Join(d.config.DownloadDir, filename)
+	partPath := downloadPath + partialSuffix
+	sidecarPath := downloadPath + sidecarSuffix
+
+	// Pick up where an earlier attempt stopped if it was for the same link
+	state, err := loadPartialState(sidecarPath)
+	if err != nil {
+		d.logger.Log("[Worker %d] %v; starting over", workerID, err)
+	}
+	var offset int64
+	if state != nil && state.SourceURL == link {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+	}
+	if offset == 0 || state == nil || state.SourceURL != link {
+		state = &partialState{SourceURL: link}
+		offset = 0
+	}
+
+	// Split the file over several connections when asked to, or when an
+	// earlier attempt left a segmented partial file behind
+	if d.config.Segments > 1 || len(state.Segments) > 0 {
+		err := d.downloadSegmented(ctx, directURL, link, filename, state, offset, partPath, sidecarPath, workerID)
+		if err == nil {
+			if err := finishPartial(partPath, sidecarPath, downloadPath); err != nil {
+				return err
+			}
+			d.logger.Log("[Worker %d] Download completed: %s", workerID, filename)
+			return nil
+		}
+		if !errors.Is(err, errRangesUnsupported) {
+			return err
+		}
+		d.logger.Log("[Worker %d] %s cannot be split; using a single connection", workerID, filename)
+		if len(state.Segments) > 0 {
+			// The segmented partial file is gone and a single stream starts over
+			state, offset = &partialState{SourceURL: link}, 0
+		}
+	}
+
+	resp, err := d.requestRange(ctx, directURL, link, offset, -1, state.validator())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			// The server answered with a range we did not ask for; start over
+			resp.Body.Close()
+			d.logger.Log("[Worker %d] Server returned an unexpected range for %s; restarting", workerID, filename)
+			offset = 0
+			if resp, err = d.requestRange(ctx, directURL, link, 0, -1, ""); err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return statusError("server", resp)
+			}
+		} else {
+			state.TotalSize = total
+			d.logger.Log("[Worker %d] Resuming %s at %d bytes", workerID, filename, offset)
+		}
+	case http.StatusOK:
+		if offset > 0 {
+			// Ranges are not supported or the file changed since the last attempt
+			d.logger.Log("[Worker %d] Server ignored resume request for %s; restarting", workerID, filename)
+			offset = 0
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Either the partial file is already complete or it is no longer valid
+		if total, err := parseUnsatisfiedRange(resp.Header.Get("Content-Range")); err == nil && total == offset {
+			if err := finishPartial(partPath, sidecarPath, downloadPath); err != nil {
+				return err
+			}
+			d.logger.Log("[Worker %d] Download completed: %s", workerID, filename)
+			return nil
+		}
+		os.Remove(partPath)
+		os.Remove(sidecarPath)
+		return fmt.Errorf("partial file for %s is no longer valid", filename)
+	default:
+		return statusError("server", resp)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		state.TotalSize = resp.ContentLength
+	}
+	state.ETag = resp.Header.Get("ETag")
+	state.LastModified = resp.Header.Get("Last-Modified")
+	state.BytesWritten = offset
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open partial file: %w", err)
+	}
+	if err := file.Truncate(offset); err == nil {
+		_, err = file.Seek(offset, 0)
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not prepare partial file: %w", err)
+	}
+	if err := state.save(sidecarPath); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write sidecar: %w", err)
+	}
+
+	if offset == 0 {
+		d.logger.Log("[Worker %d] Starting download of: %s", workerID, filename)
+	}
+
+	d.logger.StartFile(workerID, filename, state.TotalSize, offset)
+
+	writer := &checkpointWriter{file: file, state: state, sidecarPath: sidecarPath}
+	body := &progressReader{reader: d.limiter.Reader(ctx, resp.Body), onRead: func(n int) {
+		d.logger.AddBytes(workerID, int64(n))
+	}}
+	_, err = io.Copy(writer, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Always record how far we got so the next attempt can resume
+	if saveErr := state.save(sidecarPath); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return fmt.Errorf("transfer interrupted at %d bytes: %w", state.BytesWritten, err)
+	}
+
+	if state.TotalSize >= 0 && state.BytesWritten != state.TotalSize {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", state.BytesWritten, state.TotalSize)
+	}
+
+	if err := finishPartial(partPath, sidecarPath, downloadPath); err != nil {
+		return err
+	}
+
+	d.logger.Log("[Worker %d] Download completed: %s", workerID, filename)
+	return nil
+}
+
+// downloadWithBrowser lets the hoster drive a browser page until the download
+// starts and saves the file. Cancelling the context closes the page, which
+// aborts any pending step.
+func (d *Downloader) downloadWithBrowser(ctx context.Context, hoster Hoster, link string, workerID int) error {
+	browser, err := d.session.Browser()
+	if err != nil {
+		return fmt.Errorf("browser unavailable: %w", err)
+	}
+
+	// Create a new page for the download.
+	page, err := browser.NewPage(playwright.BrowserNewPageOptions{
+		AcceptDownloads: playwright.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create page: %w", err)
+	}
+	defer page.Close()
+	defer closeOnCancel(ctx, page)()
+
+	// Set a custom timeout based on config
+	timeout := float64(d.config.Timeout * 1000) // Convert seconds to ms
+
+	logf := func(format string, args ...interface{}) {
+		d.logger.Log("[Worker %d] %s", workerID, fmt.Sprintf(format, args...))
+	}
+	download, err := hoster.BrowserDownload(ctx, page, link, timeout, logf)
+	if err != nil {
+		return err
+	}
+
+	filename := extractFilenameFromURL(link)
+	d.noteOfferedName(filename, download.SuggestedFilename(), workerID)
+
+	downloadPath := filepath.Join(d.config.DownloadDir, filename)
+	d.logger.Log("[Worker %d] Starting download of: %s", workerID, filename)
+
+	// The browser does not report progress, so the size is only known once saved
+	d.logger.StartFile(workerID, filename, -1, 0)
+
+	// Save the downloaded file.
+	if err = download.SaveAs(downloadPath); err != nil {
+		return classified(errorClass(err), fmt.Errorf("failed to save download: %w", err))
+	}
+	if info, err := os.Stat(downloadPath); err == nil {
+		d.logger.AddBytes(workerID, info.Size())
+	}
+
+	d.logger.Log("[Worker %d] Download completed: %s", workerID, filename)
+	return nil
+}
+
+// requestRange issues a GET for the direct URL, asking for the bytes from offset
+// up to end (inclusive) when offset is positive or end is given. end is -1 for
+// the rest of the file.
+func (d *Downloader) requestRange(ctx context.Context, directURL, referer string, offset, end int64, validator string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, directURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Referer", referer)
+	if offset > 0 || end >= 0 {
+		if end >= 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+		} else {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		if validator != "" {
+			// The server sends the whole file instead if it changed
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// finishPartial moves a completed .part file to its final name and removes the sidecar
+func finishPartial(partPath, sidecarPath, downloadPath string) error {
+	if err := os.Rename(partPath, downloadPath); err != nil {
+		return fmt.Errorf("could not finalize download: %w", err)
+	}
+	os.Remove(sidecarPath)
+	return nil
+}
+
+// progressReader reports every read to a callback so transfers can show
+// byte-level progress
+type progressReader struct {
+	reader io.Reader
+	onRead func(n int)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	if n > 0 {
+		pr.onRead(n)
+	}
+	return n, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadDirectSavesUnderLinkName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive data"))
+	}))
+	defer server.Close()
+
+	// The hoster offers the file under another name than the link's
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: server.URL, Filename: "renamed-by-hoster.rar", Size: -1}}
+	config := Config{DownloadDir: t.TempDir()}
+	d := NewDownloader(config, server.Client(), nil, NewConsoleLogger(1, 1, "test"), nil, nil)
+
+	if err := d.downloadDirect(context.Background(), hoster, "https://fake.test/abc#Game.part01.rar", 1); err != nil {
+		t.Fatalf("downloadDirect: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.DownloadDir, "Game.part01.rar"))
+	if err != nil {
+		t.Fatalf("file was not saved under the link's name: %v", err)
+	}
+	if string(data) != "archive data" {
+		t.Errorf("saved %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(config.DownloadDir, "renamed-by-hoster.rar")); err == nil {
+		t.Error("file was saved under the hoster's name")
+	}
+}
+
+// resumeContent is the file served by the resume tests
+var resumeContent = strings.Repeat("0123456789", 100)
+
+// startPartial leaves the first n bytes of resumeContent behind as an
+// interrupted download of link
+func startPartial(t *testing.T, dir, filename, link string, n int) {
+	t.Helper()
+
+	path := filepath.Join(dir, filename)
+	if err := os.WriteFile(path+partialSuffix, []byte(resumeContent[:n]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := &partialState{SourceURL: link, TotalSize: int64(len(resumeContent)), BytesWritten: int64(n)}
+	if err := state.save(path + sidecarSuffix); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resumeServer serves resumeContent through handler and records the Range
+// header of every request
+func resumeServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mutex.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &ranges
+}
+
+// serveRanges answers range requests like a well-behaved file server
+func serveRanges(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(resumeContent))
+}
+
+// downloadResumed runs a direct download of link against server and returns
+// the finished file
+func downloadResumed(t *testing.T, server *httptest.Server, dir, link string) string {
+	t.Helper()
+
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: server.URL, Size: -1}}
+	d := NewDownloader(Config{DownloadDir: dir}, server.Client(), nil, NewConsoleLogger(1, 1, "test"), nil, nil)
+	if err := d.downloadDirect(context.Background(), hoster, link, 1); err != nil {
+		t.Fatalf("downloadDirect: %v", err)
+	}
+
+	path := filepath.Join(dir, extractFilenameFromURL(link))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("file was not finished: %v", err)
+	}
+	for _, leftover := range []string{path + partialSuffix, path + sidecarSuffix} {
+		if _, err := os.Stat(leftover); err == nil {
+			t.Errorf("%s was left behind", filepath.Base(leftover))
+		}
+	}
+	return string(data)
+}
+
+func TestDownloadDirectResumesWithRange(t *testing.T) {
+	server, ranges := resumeServer(t, serveRanges)
+	dir := t.TempDir()
+	link := "https://fake.test/abc#Game.part01.rar"
+	startPartial(t, dir, "Game.part01.rar", link, 300)
+
+	if got := downloadResumed(t, server, dir, link); got != resumeContent {
+		t.Errorf("resumed file has %d bytes, want %d", len(got), len(resumeContent))
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=300-" {
+		t.Errorf("requests asked for %q, want one for bytes=300-", *ranges)
+	}
+}
+
+func TestDownloadDirectRestartsWhenRangeIgnored(t *testing.T) {
+	server, ranges := resumeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resumeContent))
+	})
+	dir := t.TempDir()
+	link := "https://fake.test/abc#Game.part01.rar"
+	startPartial(t, dir, "Game.part01.rar", link, 300)
+
+	// The whole file arrives again and must not be appended to the partial one
+	if got := downloadResumed(t, server, dir, link); got != resumeContent {
+		t.Errorf("file has %d bytes, want %d", len(got), len(resumeContent))
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=300-" {
+		t.Errorf("requests asked for %q, want one for bytes=300-", *ranges)
+	}
+}
+
+func TestDownloadDirectFinishesCompletePartial(t *testing.T) {
+	server, ranges := resumeServer(t, serveRanges)
+	dir := t.TempDir()
+	link := "https://fake.test/abc#Game.part01.rar"
+	startPartial(t, dir, "Game.part01.rar", link, len(resumeContent))
+
+	// The server answers 416 with "bytes */1000"; nothing is downloaded again
+	if got := downloadResumed(t, server, dir, link); got != resumeContent {
+		t.Errorf("file has %d bytes, want %d", len(got), len(resumeContent))
+	}
+	if len(*ranges) != 1 {
+		t.Errorf("made %d requests, want 1", len(*ranges))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// filterCompleted splits the links into those that still need downloading and
+// those whose file is already complete in the download directory. Files are
+// checked config.WorkerCount at a time, as many as will be downloaded at once.
+func filterCompleted(ctx context.Context, links []string, config Config, client *http.Client, checksums ChecksumManifest, state *JobState) (pending, skipped []string) {
+	present := make([]bool, len(links))
+	forEachConcurrently(ctx, config.WorkerCount, len(links), func(i int) {
+		present[i] = isAlreadyDownloaded(ctx, links[i], config, client, checksums, state.RecordedSize(links[i]))
+	})
+
+	for i, link := range links {
+		if present[i] && ctx.Err() == nil {
+			skipped = append(skipped, link)
+		} else {
+			pending = append(pending, link)
+		}
+	}
+	return pending, skipped
+}
+
+// isAlreadyDownloaded reports whether the file for a link is present in the
+// download directory and matches its checksum, or the size announced by the
+// server when no checksum is known. recordedSize is the size the job state
+// recorded when the file was done, or 0.
+func isAlreadyDownloaded(ctx context.Context, link string, config Config, client *http.Client, checksums ChecksumManifest, recordedSize int64) bool {
+	filename := extractFilenameFromURL(link)
+	path := filepath.Join(config.DownloadDir, filename)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() == 0 {
+		return false
+	}
+
+	if ok, known, err := checksums.Verify(path); known {
+		if err != nil || !ok {
+			log.Printf("Existing %s does not match its checksum; downloading again", filename)
+			return false
+		}
+		return true
+	}
+
+	// Without the server's size (e.g. the hoster is down) only the job state
+	// can vouch for the file. Downloading again is safe: the existing file is
+	// only replaced once the new one is complete.
+	remoteSize, err := probeRemoteSize(ctx, link, client)
+	if err != nil {
+		if recordedSize > 0 && recordedSize == info.Size() {
+			log.Printf("Could not check size of %s: %v; keeping it, as it has its recorded size", filename, err)
+			return true
+		}
+		log.Printf("Could not check size of %s: %v; downloading it again", filename, err)
+		return false
+	}
+	if remoteSize >= 0 && remoteSize != info.Size() {
+		log.Printf("Existing %s has %d bytes, expected %d; downloading again", filename, info.Size(), remoteSize)
+		return false
+	}
+
+	return true
+}
+
+// probeRemoteSize resolves a link and asks the server for the file size without
+// downloading it. Returns -1 when the server does not announce a size.
+func probeRemoteSize(ctx context.Context, link string, client *http.Client) (int64, error) {
+	hoster, err := hosterFor(link)
+	if err != nil {
+		return 0, err
+	}
+
+	resolved, err := hoster.Resolve(ctx, link, client)
+	if err != nil {
+		return 0, err
+	}
+	if resolved.Size >= 0 {
+		return resolved.Size, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, resolved.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Referer", link)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return resp.ContentLength, nil
+}
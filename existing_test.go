@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// probeHoster announces a fixed size for every file, or fails when down, and
+// records how many probes ran at the same time
+type probeHoster struct {
+	fakeHoster
+	size  int64
+	down  bool
+	delay time.Duration
+
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (h *probeHoster) Resolve(ctx context.Context, link string, client *http.Client) (*ResolvedLink, error) {
+	h.mutex.Lock()
+	h.inFlight++
+	h.peak = max(h.peak, h.inFlight)
+	h.mutex.Unlock()
+
+	time.Sleep(h.delay)
+
+	h.mutex.Lock()
+	h.inFlight--
+	h.mutex.Unlock()
+
+	if h.down {
+		return nil, errors.New("hoster is down")
+	}
+	return &ResolvedLink{URL: "https://files.test/direct", Size: h.size}, nil
+}
+
+// useHoster replaces the hoster registry for the duration of a test
+func useHoster(t *testing.T, registry ...Hoster) {
+	saved := hosters
+	hosters = registry
+	t.Cleanup(func() { hosters = saved })
+}
+
+// writeFile creates a file of the given size in dir
+func writeFile(t *testing.T, dir, name string, size int) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilterCompletedComparesSizes(t *testing.T) {
+	useHoster(t, &probeHoster{size: 10})
+	dir := t.TempDir()
+	writeFile(t, dir, "complete.bin", 10)
+	writeFile(t, dir, "truncated.bin", 4)
+
+	links := []string{
+		"https://fake.test/a#complete.bin",
+		"https://fake.test/b#truncated.bin",
+		"https://fake.test/c#missing.bin",
+	}
+	config := Config{DownloadDir: dir, WorkerCount: 2}
+	pending, skipped := filterCompleted(context.Background(), links, config, http.DefaultClient, nil, testJobState(dir, links))
+
+	if want := links[1:]; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending %v, want %v", pending, want)
+	}
+	if want := links[:1]; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %v, want %v", skipped, want)
+	}
+}
+
+func TestFilterCompletedProbesConcurrently(t *testing.T) {
+	hoster := &probeHoster{size: 10, delay: 50 * time.Millisecond}
+	useHoster(t, hoster)
+	dir := t.TempDir()
+
+	var links []string
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		writeFile(t, dir, name+".bin", 10)
+		links = append(links, "https://fake.test/"+name+"#"+name+".bin")
+	}
+	config := Config{DownloadDir: dir, WorkerCount: 4}
+	_, skipped := filterCompleted(context.Background(), links, config, http.DefaultClient, nil, testJobState(dir, links))
+
+	if len(skipped) != len(links) {
+		t.Errorf("skipped %d files, want %d", len(skipped), len(links))
+	}
+	if hoster.peak < 2 || hoster.peak > 4 {
+		t.Errorf("%d probes ran at once, want 2 to 4", hoster.peak)
+	}
+}
+
+func TestFilterCompletedWithoutProbe(t *testing.T) {
+	server, _ := resumeServer(t, serveRanges)
+	dir := t.TempDir()
+	config := Config{DownloadDir: dir, WorkerCount: 2, SkipSelection: true}
+	links := []string{
+		"https://fake.test/a#done.bin",
+		"https://fake.test/b#truncated.bin",
+		"https://fake.test/c#unknown.bin",
+	}
+
+	// A first run downloads two files the way the worker pool does
+	first, err := newSourceJob(config, "https://paste.test/?abc", links, nil, false, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: server.URL, Size: -1}}
+	d := NewDownloader(config, server.Client(), nil, NewConsoleLogger(1, 1, "test"), nil, nil)
+	for _, link := range links[:2] {
+		if err := d.downloadDirect(context.Background(), hoster, link, 1); err != nil {
+			t.Fatalf("downloadDirect: %v", err)
+		}
+		if err := first.state.SetStatus(link, StatusDone, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Truncate(filepath.Join(dir, "truncated.bin"), 10)
+	// A file the job state knows nothing about is not trusted
+	writeFile(t, dir, "unknown.bin", 10)
+
+	// A second run of the same paste cannot reach the hoster
+	useHoster(t, &probeHoster{down: true})
+	second, err := newSourceJob(config, "https://paste.test/?abc", links, nil, false, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, skipped := filterCompleted(context.Background(), links, config, http.DefaultClient, nil, second.state)
+
+	if want := links[1:]; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending %v, want %v", pending, want)
+	}
+	if want := links[:1]; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %v, want %v", skipped, want)
+	}
+}
+
+// testJobState creates the job state of a fresh run selecting every link
+func testJobState(dir string, links []string) *JobState {
+	return NewJobState(dir, "https://paste.test/?abc", groupDownloadLinks(links))
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exportEntry is one file resolved to a direct link for another downloader
+type exportEntry struct {
+	Package  string
+	Dir      string
+	Filename string
+	URL      string
+	// Page is the hoster page the direct link was resolved from
+	Page string
+}
+
+// exportFormats maps the --format values to their writers
+var exportFormats = map[string]func(io.Writer, []exportEntry) error{
+	"aria2":    writeAria2Input,
+	"crawljob": writeCrawljob,
+	"txt":      writeTextList,
+	"csv":      writeCSVList,
+}
+
+// exportFormatNames lists the supported --format values for messages
+func exportFormatNames() string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// runExport runs extraction, grouping and selection for every source like a
+// normal run, resolves the selected files to direct links and writes them in
+// config.ExportFormat instead of downloading them
+func runExport(ctx context.Context, config Config, session *BrowserSession, sources []string) error {
+	write, ok := exportFormats[config.ExportFormat]
+	if !ok {
+		return fmt.Errorf("unknown export format %q (supported: %s)", config.ExportFormat, exportFormatNames())
+	}
+
+	if config.ExportOutput == "-" {
+		console = os.Stderr
+	}
+
+	client := newHTTPClient(config)
+	batch := len(sources) > 1
+	usedDirs := make(map[string]bool)
+
+	var entries []exportEntry
+	var failed int
+	collect := func(sourceURL string, links []string, release *ReleaseInfo) {
+		groups := selectGroups(config, links, release)
+		if groups == nil {
+			return
+		}
+
+		name := gameName(release, groups, sourceURL)
+		dir := config.DownloadDir
+		if batch {
+			dir = filepath.Join(dir, uniqueDirName(name, usedDirs))
+		}
+
+		resolved, unresolved := resolveExportEntries(ctx, client, groups, name, dir)
+		entries = append(entries, resolved...)
+		failed += unresolved
+	}
+
+	if config.LinksFile != "" {
+		links, err := readURLList(config.LinksFile, "links file")
+		if err != nil {
+			return err
+		}
+		collect(config.LinksFile, links, nil)
+	}
+	for i, source := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+		if batch {
+			log.Printf("[%d/%d] Resolving %s", i+1, len(sources), source)
+		}
+
+		links, release, err := resolveLinks(ctx, source, config, session)
+		if err != nil {
+			log.Printf("Failed to extract URLs from %s: %v", source, err)
+			continue
+		}
+		collect(source, links, release)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("nothing to export")
+	}
+	if err := writeExport(config.ExportOutput, entries, write); err != nil {
+		return err
+	}
+
+	log.Printf("Exported %d %s as %s", len(entries), pluralize("file", len(entries)), config.ExportFormat)
+	if failed > 0 {
+		log.Printf("Could not resolve %d %s; they are not in the export", failed, pluralize("file", failed))
+	}
+	return nil
+}
+
+// resolveExportEntries resolves the files of the selected groups to direct
+// links, trying the mirrors of a file when its primary link fails. Returns the
+// entries and the number of files that could not be resolved.
+func resolveExportEntries(ctx context.Context, client *http.Client, groups []FileGroup, pkg, dir string) ([]exportEntry, int) {
+	var entries []exportEntry
+	failed := 0
+	for _, group := range groups {
+		if !group.Selected {
+			continue
+		}
+		for _, link := range group.Files {
+			if ctx.Err() != nil {
+				return entries, failed
+			}
+
+			entry, err := resolveExportEntry(ctx, client, group.Sources(link))
+			if err != nil {
+				log.Printf("Could not resolve %s: %v", extractFilenameFromURL(link), err)
+				failed++
+				continue
+			}
+			entry.Package = pkg
+			entry.Dir = dir
+			entries = append(entries, entry)
+		}
+	}
+	return entries, failed
+}
+
+// resolveExportEntry resolves the first source a hoster can turn into a direct link
+func resolveExportEntry(ctx context.Context, client *http.Client, sources []string) (exportEntry, error) {
+	err := fmt.Errorf("no supported hoster")
+	for _, source := range sources {
+		hoster, hosterErr := hosterFor(source)
+		if hosterErr != nil {
+			continue
+		}
+
+		resolved, resolveErr := hoster.Resolve(ctx, source, client)
+		if resolveErr != nil {
+			err = resolveErr
+			continue
+		}
+
+		// Saved under the primary link's name, so verify finds the file
+		return exportEntry{Filename: extractFilenameFromURL(sources[0]), URL: resolved.URL, Page: source}, nil
+	}
+	return exportEntry{}, err
+}
+
+// writeExport writes the entries to a file, or to stdout when the path is "-"
+func writeExport(path string, entries []exportEntry, write func(io.Writer, []exportEntry) error) error {
+	if path == "-" {
+		return write(os.Stdout, entries)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create export file: %w", err)
+	}
+	if err := write(file, entries); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write export file: %w", err)
+	}
+	return file.Close()
+}
+
+// writeAria2Input writes an aria2c --input-file: each URI followed by indented
+// per-download options
+func writeAria2Input(w io.Writer, entries []exportEntry) error {
+	for _, entry := range entries {
+		// The fragment only carries the filename and is never sent as a referer
+		referer, _, _ := strings.Cut(entry.Page, "#")
+		_, err := fmt.Fprintf(w, "%s\n  out=%s\n  dir=%s\n  referer=%s\n  user-agent=%s\n",
+			entry.URL, entry.Filename, entry.Dir, referer, userAgent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crawljobEntry is one link of a JDownloader folder watch .crawljob file
+type crawljobEntry struct {
+	Text           string `json:"text"`
+	PackageName    string `json:"packageName"`
+	Filename       string `json:"filename"`
+	DownloadFolder string `json:"downloadFolder"`
+	Enabled        string `json:"enabled"`
+	AutoStart      string `json:"autoStart"`
+	AutoConfirm    string `json:"autoConfirm"`
+}
+
+// writeCrawljob writes a JSON crawljob for JDownloader's folder watch
+func writeCrawljob(w io.Writer, entries []exportEntry) error {
+	jobs := make([]crawljobEntry, 0, len(entries))
+	for _, entry := range entries {
+		dir, err := filepath.Abs(entry.Dir)
+		if err != nil {
+			dir = entry.Dir
+		}
+		jobs = append(jobs, crawljobEntry{
+			Text:           entry.URL,
+			PackageName:    entry.Package,
+			Filename:       entry.Filename,
+			DownloadFolder: dir,
+			Enabled:        "TRUE",
+			AutoStart:      "TRUE",
+			AutoConfirm:    "TRUE",
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jobs)
+}
+
+// writeTextList writes one direct link per line
+func writeTextList(w io.Writer, entries []exportEntry) error {
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(w, entry.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSVList writes the entries with a header row
+func writeCSVList(w io.Writer, entries []exportEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"package", "filename", "dir", "url", "page"})
+	for _, entry := range entries {
+		writer.Write([]string{entry.Package, entry.Filename, entry.Dir, entry.URL, entry.Page})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// extractors are looked up in PATH when --extractor is not given, in order of
+// preference; 7-Zip needs its RAR codec, which the p7zip "full" builds include
+var extractors = []string{"unrar", "7z", "7zz"}
+
+var (
+	// extractPercentRegex matches the progress both tools print
+	extractPercentRegex = regexp.MustCompile(`(\d{1,3})%`)
+	// volumeRegex matches the volume unrar is currently reading
+	volumeRegex = regexp.MustCompile(`^Extracting from (.+)$`)
+	// missingVolumeRegex matches the volume unrar or 7-Zip could not find
+	missingVolumeRegex = regexp.MustCompile(`(?:Cannot find volume|Missing volume\s*:)\s*(.+)$`)
+)
+
+// extractTask is a group whose parts are all downloaded
+type extractTask struct {
+	job   *Job
+	group *FileGroup
+}
+
+// extractor unpacks finished RAR groups one at a time with an external unrar
+// or 7-Zip while the remaining downloads continue. Parts the tool reports as
+// missing or damaged are deleted and collected for downloading again.
+type extractor struct {
+	tool     string
+	sevenZip bool
+	logger   *ConsoleLogger
+	queue    chan extractTask
+	busy     sync.WaitGroup
+	stopped  chan struct{}
+
+	mutex   sync.Mutex
+	queued  map[*FileGroup]bool
+	repairs []downloadTask
+}
+
+// findExtractor returns the path of the configured tool, or of the first one
+// of extractors found in PATH
+func findExtractor(tool string) (string, error) {
+	if tool != "" {
+		return exec.LookPath(tool)
+	}
+	for _, name := range extractors {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s found in PATH; install one or set --extractor", strings.Join(extractors, ", "))
+}
+
+// newExtractor creates the extraction stage for the RAR groups of the jobs.
+// Returns nil when --extract is off.
+func newExtractor(config Config, jobs []*Job) (*extractor, error) {
+	if !config.Extract {
+		return nil, nil
+	}
+	tool, err := findExtractor(config.Extractor)
+	if err != nil {
+		return nil, fmt.Errorf("cannot extract archives: %w", err)
+	}
+
+	// Every group is queued at most once at a time, so submit never blocks
+	groups := 0
+	for _, job := range jobs {
+		if job.err == nil {
+			groups += len(job.state.Groups)
+		}
+	}
+	return &extractor{
+		tool:     tool,
+		sevenZip: strings.Contains(strings.ToLower(filepath.Base(tool)), "7z"),
+		queue:    make(chan extractTask, groups),
+		stopped:  make(chan struct{}),
+		queued:   make(map[*FileGroup]bool),
+	}, nil
+}
+
+// start runs the extraction loop and queues the groups that were already
+// complete before the run
+func (e *extractor) start(ctx context.Context, jobs []*Job, logger *ConsoleLogger) {
+	if e == nil {
+		return
+	}
+	e.logger = logger
+	go func() {
+		defer close(e.stopped)
+		for task := range e.queue {
+			e.extract(ctx, task)
+			e.mutex.Lock()
+			delete(e.queued, task.group)
+			e.mutex.Unlock()
+			e.busy.Done()
+		}
+	}()
+
+	for _, job := range jobs {
+		if job.err != nil {
+			continue
+		}
+		for _, link := range job.selected {
+			job.fileDone(link)
+		}
+	}
+}
+
+// submit queues a complete group for extraction unless it is queued already
+// or holds no RAR archive
+func (e *extractor) submit(job *Job, group *FileGroup) {
+	if len(group.Files) == 0 || !strings.HasSuffix(strings.ToLower(extractFilenameFromURL(group.Files[0])), ".rar") {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.queued[group] {
+		return
+	}
+	e.queued[group] = true
+	e.busy.Add(1)
+	e.queue <- extractTask{job: job, group: group}
+}
+
+// wait blocks until every queued group is handled and returns the parts that
+// have to be downloaded again
+func (e *extractor) wait() []downloadTask {
+	if e == nil {
+		return nil
+	}
+	e.busy.Wait()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	repairs := e.repairs
+	e.repairs = nil
+	return repairs
+}
+
+// stop ends the extraction loop once the queue is empty
+func (e *extractor) stop() {
+	if e == nil {
+		return
+	}
+	close(e.queue)
+	<-e.stopped
+}
+
+// extract unpacks one group and records the outcome in its job
+func (e *extractor) extract(ctx context.Context, task extractTask) {
+	job, group := task.job, task.group
+	if ctx.Err() != nil {
+		return
+	}
+
+	// A part deleted since it was downloaded needs no extractor to notice
+	var missing []string
+	for _, link := range group.Files {
+		path := filepath.Join(job.config.DownloadDir, extractFilenameFromURL(link))
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, link)
+		}
+	}
+	if len(missing) > 0 {
+		e.repair(job, group, missing, fmt.Errorf("%d %s missing", len(missing), pluralize("part", len(missing))))
+		return
+	}
+
+	dest := job.extractDir()
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		e.fail(job, group, fmt.Errorf("could not create extraction directory: %w", err))
+		return
+	}
+
+	e.logger.Log("Extracting %s into %s", group.Name, dest)
+	bad, err := e.run(ctx, job, group, dest)
+	e.logger.FinishExtraction(group.Name)
+	if ctx.Err() != nil {
+		e.logger.Log("Extraction of %s interrupted", group.Name)
+		return
+	}
+	if err != nil {
+		if len(bad) == 0 {
+			bad = job.checksums.mismatched(job.config.DownloadDir, group.Files)
+		}
+		if len(bad) > 0 {
+			e.repair(job, group, bad, err)
+		} else {
+			e.fail(job, group, err)
+		}
+		return
+	}
+
+	if err := job.state.SetExtracted(group); err != nil {
+		e.logger.Log("Could not update job state: %v", err)
+	}
+	job.extracted++
+	e.logger.Log("Extracted %s", group.Name)
+
+	if job.config.DeleteArchives {
+		for _, link := range group.Files {
+			os.Remove(filepath.Join(job.config.DownloadDir, extractFilenameFromURL(link)))
+		}
+		e.logger.Log("Deleted %d %s of %s", len(group.Files), pluralize("archive part", len(group.Files)), group.Name)
+	}
+}
+
+// run starts the tool on the first volume and follows its output. It returns
+// the parts the tool named as missing or damaged when it fails.
+func (e *extractor) run(ctx context.Context, job *Job, group *FileGroup, dest string) ([]string, error) {
+	first := filepath.Join(job.config.DownloadDir, extractFilenameFromURL(group.Files[0]))
+
+	var cmd *exec.Cmd
+	if e.sevenZip {
+		cmd = exec.CommandContext(ctx, e.tool, "x", "-y", "-bsp1", "-o"+dest, first)
+	} else {
+		// -p- keeps unrar from waiting for a password on an encrypted archive
+		cmd = exec.CommandContext(ctx, e.tool, "x", "-o+", "-y", "-p-", first, dest+string(filepath.Separator))
+	}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start %s: %w", filepath.Base(e.tool), err)
+	}
+
+	// Parts are matched by name because the tool prints full volume paths
+	partOf := make(map[string]string, len(group.Files))
+	for _, link := range group.Files {
+		partOf[strings.ToLower(extractFilenameFromURL(link))] = link
+	}
+	var bad []string
+	markBad := func(volume string) {
+		link, ok := partOf[strings.ToLower(filepath.Base(strings.TrimSpace(volume)))]
+		if !ok {
+			return
+		}
+		for _, known := range bad {
+			if known == link {
+				return
+			}
+		}
+		bad = append(bad, link)
+	}
+
+	var volume, lastError string
+	percent := -1
+	scanner := bufio.NewScanner(output)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if matches := volumeRegex.FindStringSubmatch(line); matches != nil {
+			volume = matches[1]
+			continue
+		}
+		if matches := missingVolumeRegex.FindStringSubmatch(line); matches != nil {
+			markBad(matches[1])
+			lastError = line
+			continue
+		}
+
+		lower := strings.ToLower(line)
+		if isExtractError(lower) {
+			lastError = line
+			if volume != "" {
+				markBad(volume)
+			}
+			continue
+		}
+		if matches := extractPercentRegex.FindStringSubmatch(line); matches != nil {
+			if value, _ := strconv.Atoi(matches[1]); value != percent && value <= 100 {
+				percent = value
+				e.logger.SetExtraction(group.Name, percent)
+			}
+		}
+	}
+	// Drain the rest so the tool never blocks on a full pipe
+	io.Copy(io.Discard, output)
+
+	if err := cmd.Wait(); err != nil {
+		if lastError != "" {
+			err = errors.New(lastError)
+		}
+		return bad, fmt.Errorf("%s failed: %w", filepath.Base(e.tool), err)
+	}
+	return nil, nil
+}
+
+// isExtractError reports whether a lowercased output line describes damage
+func isExtractError(line string) bool {
+	for _, marker := range []string{"crc failed", "checksum error", "corrupt", "unexpected end of archive", "data error"} {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanProgressLines splits tool output on newlines, carriage returns and the
+// backspaces used to redraw the progress in place
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\n\r\b"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// repair deletes the damaged or missing parts of a group and queues them for
+// downloading again
+func (e *extractor) repair(job *Job, group *FileGroup, parts []string, cause error) {
+	e.logger.Log("Extraction of %s failed (%v); downloading %d %s again",
+		group.Name, cause, len(parts), pluralize("part", len(parts)))
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, link := range parts {
+		name := extractFilenameFromURL(link)
+		os.Remove(filepath.Join(job.config.DownloadDir, name))
+		if err := job.state.SetStatus(link, StatusPending, "damaged: "+cause.Error()); err != nil {
+			e.logger.Log("Could not update job state: %v", err)
+		}
+		e.repairs = append(e.repairs, downloadTask{link: link, job: job})
+		job.repaired++
+	}
+}
+
+// fail records a group that could not be extracted and cannot be repaired
+func (e *extractor) fail(job *Job, group *FileGroup, err error) {
+	e.logger.Log("Extraction of %s failed: %v", group.Name, err)
+	job.extractFailed = append(job.extractFailed, fmt.Sprintf("%s (%v)", group.Name, err))
+}
+
+// extractDir is where the job's archives are unpacked: --extract-dir, with a
+// subdirectory per game in batch mode, or else the download directory
+func (j *Job) extractDir() string {
+	if j.config.ExtractDir == "" {
+		return j.config.DownloadDir
+	}
+	return filepath.Join(j.config.ExtractDir, j.Name)
+}
+
+// fileDone hands the group of a finished file to the extractor once all its
+// parts are done
+func (j *Job) fileDone(link string) {
+	if j.extractor == nil {
+		return
+	}
+	if group := j.state.CompletedGroup(link); group != nil {
+		j.extractor.submit(j, group)
+	}
+}
+
+// runRepairRounds downloads the parts the extractor rejected and extracts
+// their groups again, up to config.RetryAttempts times. The parts were counted
+// as successful already, so only their failures are added to the summaries.
+func runRepairRounds(ctx context.Context, config Config, extractor *extractor, logger *ConsoleLogger, jobs []*Job, summary *DownloadSummary) {
+	for round := 1; ; round++ {
+		repairs := extractor.wait()
+		if len(repairs) == 0 || ctx.Err() != nil || summary.Aborted != nil {
+			return
+		}
+		if round > config.RetryAttempts {
+			logger.Log("Giving up on %d damaged %s", len(repairs), pluralize("part", len(repairs)))
+			for _, task := range repairs {
+				setStatus(task.job.state, logger, task.link, StatusFailed, "damaged after repeated downloads")
+			}
+			return
+		}
+
+		logger.Log("Downloading %d damaged %s again", len(repairs), pluralize("part", len(repairs)))
+		logger.AddFiles(len(repairs))
+		saved := make(map[*Job]DownloadSummary, len(jobs))
+		for _, job := range jobs {
+			saved[job] = job.summary
+		}
+
+		repaired := runWorkerPool(ctx, repairs, logger, config)
+
+		for _, job := range jobs {
+			job.summary.Succeeded = saved[job].Succeeded
+			job.summary.FromMirror = saved[job].FromMirror
+		}
+		summary.Failed += repaired.Failed
+		summary.Cancelled += repaired.Cancelled
+		for class, count := range repaired.Reasons {
+			if summary.Reasons == nil {
+				summary.Reasons = make(map[ErrorClass]int)
+			}
+			summary.Reasons[class] += count
+		}
+		if repaired.Aborted != nil {
+			summary.Aborted = repaired.Aborted
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanProgressLines(t *testing.T) {
+	output := "Extracting from Game.part1.rar\n\n  5%\b\b\b\b 10%\b\b\b\b\rCRC failed in Game.bin"
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Split(scanProgressLines)
+	var lines []string
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	want := []string{"Extracting from Game.part1.rar", "5%", "10%", "CRC failed in Game.bin"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines %q, want %q", lines, want)
+	}
+}
+
+func TestExtractorRunFindsBadParts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake extractor is a shell script")
+	}
+
+	links := []string{
+		"https://fake.test/a#Game.part1.rar",
+		"https://fake.test/b#Game.part2.rar",
+		"https://fake.test/c#Game.part3.rar",
+	}
+	tests := []struct {
+		name   string
+		output string
+		status int
+		bad    []string
+		err    string
+	}{
+		{"success", "Extracting from /dl/Game.part1.rar\n 50%\n100%\nAll OK", 0, nil, ""},
+		{"damaged part", "Extracting from /dl/Game.part1.rar\nExtracting from /dl/Game.part2.rar\nGame.bin - CRC failed", 3,
+			links[1:2], "CRC failed"},
+		{"missing part", "Extracting from /dl/Game.part2.rar\nCannot find volume /dl/Game.part3.rar", 10,
+			links[2:], "Cannot find volume"},
+		{"other failure", "Cannot create Game.bin", 9, nil, "exit status 9"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tool := filepath.Join(dir, "unrar")
+			script := "#!/bin/sh\ncat <<'EOF'\n" + test.output + "\nEOF\nexit " + strconv.Itoa(test.status) + "\n"
+			if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			e := &extractor{tool: tool, logger: NewConsoleLogger(1, 1, "test")}
+			job := &Job{config: Config{DownloadDir: dir}}
+			group := &FileGroup{Name: "Game", Files: links}
+			bad, err := e.run(context.Background(), job, group, filepath.Join(dir, "out"))
+
+			if !reflect.DeepEqual(bad, test.bad) {
+				t.Errorf("bad parts %v, want %v", bad, test.bad)
+			}
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("run: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// ErrorClass tells why a download failed and decides how it is retried
+type ErrorClass int
+
+const (
+	ClassOther ErrorClass = iota
+	ClassTimeout
+	ClassButtonMissing
+	ClassRateLimited
+	ClassFileRemoved
+	ClassDiskFull
+	ClassChecksumMismatch
+)
+
+// String names the class in logs and the summary
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassTimeout:
+		return "timeout"
+	case ClassButtonMissing:
+		return "download button missing"
+	case ClassRateLimited:
+		return "rate limited"
+	case ClassFileRemoved:
+		return "file removed"
+	case ClassDiskFull:
+		return "disk full"
+	case ClassChecksumMismatch:
+		return "checksum mismatch"
+	default:
+		return "other error"
+	}
+}
+
+const (
+	// rateLimitBackoff is the first wait after a rate limit; it doubles per attempt
+	rateLimitBackoff = 5 * time.Second
+	// maxRateLimitBackoff caps the exponential backoff
+	maxRateLimitBackoff = 2 * time.Minute
+)
+
+// DownloadError is a download failure with its class
+type DownloadError struct {
+	Class ErrorClass
+	Err   error
+	// RetryAfter is the wait the server asked for, if any
+	RetryAfter time.Duration
+}
+
+func (e *DownloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// classified wraps err with a class unless it already carries one
+func classified(class ErrorClass, err error) error {
+	var downloadErr *DownloadError
+	if err == nil || errors.As(err, &downloadErr) {
+		return err
+	}
+	return &DownloadError{Class: class, Err: err}
+}
+
+// statusError describes an unexpected HTTP status, classifying rate limits
+// and removed files
+func statusError(what string, resp *http.Response) error {
+	err := &DownloadError{Err: fmt.Errorf("%s returned %s", what, resp.Status)}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		err.Class = ClassRateLimited
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case http.StatusNotFound, http.StatusGone:
+		err.Class = ClassFileRemoved
+	}
+	return err
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
+
+// errorClass returns the class of a download error, recognising timeouts and
+// a full disk in errors that were not classified where they happened
+func errorClass(err error) ErrorClass {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Class
+	}
+
+	var netErr net.Error
+	switch {
+	case isDiskFull(err):
+		return ClassDiskFull
+	case errors.Is(err, playwright.ErrTimeout):
+		return ClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	}
+	return ClassOther
+}
+
+// isDiskFull reports whether err comes from writing to a full disk
+func isDiskFull(err error) bool {
+	for _, target := range diskFullErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay decides whether a failed attempt is worth repeating on the same
+// source and how long to wait first. Rate limits back off exponentially with
+// jitter, removed files and a full disk are not retried.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	switch errorClass(err) {
+	case ClassFileRemoved, ClassDiskFull:
+		return 0, false
+	case ClassRateLimited:
+		delay := rateLimitBackoff << (attempt - 1)
+		if delay > maxRateLimitBackoff || delay <= 0 {
+			delay = maxRateLimitBackoff
+		}
+		// Spread the retries of concurrent workers over 50-150% of the delay
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay)))
+
+		var downloadErr *DownloadError
+		if errors.As(err, &downloadErr) && downloadErr.RetryAfter > delay {
+			delay = downloadErr.RetryAfter
+		}
+		return delay, true
+	default:
+		return time.Duration(attempt) * 2 * time.Second, true
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		class      ErrorClass
+		wait       time.Duration
+	}{
+		{http.StatusNotFound, "", ClassFileRemoved, 0},
+		{http.StatusGone, "", ClassFileRemoved, 0},
+		{http.StatusTooManyRequests, "30", ClassRateLimited, 30 * time.Second},
+		{http.StatusServiceUnavailable, "", ClassRateLimited, 0},
+		{http.StatusForbidden, "30", ClassOther, 0},
+		{http.StatusInternalServerError, "", ClassOther, 0},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Status: fmt.Sprintf("%d %s", test.status, http.StatusText(test.status)), Header: http.Header{}}
+		if test.retryAfter != "" {
+			resp.Header.Set("Retry-After", test.retryAfter)
+		}
+
+		err := statusError("server", resp)
+		var downloadErr *DownloadError
+		if !errors.As(err, &downloadErr) {
+			t.Fatalf("%d: %v is not a DownloadError", test.status, err)
+		}
+		if downloadErr.Class != test.class || downloadErr.RetryAfter != test.wait {
+			t.Errorf("%d: class %s waiting %s, want %s waiting %s", test.status, downloadErr.Class, downloadErr.RetryAfter, test.class, test.wait)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"", 0, 0},
+		{"0", 0, 0},
+		{"soon", 0, 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s to %s", test.value, got, test.min, test.max)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	rateLimited := &DownloadError{Class: ClassRateLimited, Err: errors.New("429")}
+	tests := []struct {
+		name     string
+		err      error
+		attempt  int
+		retry    bool
+		min, max time.Duration
+	}{
+		{"removed file", &DownloadError{Class: ClassFileRemoved, Err: errors.New("404")}, 1, false, 0, 0},
+		{"full disk", fmt.Errorf("could not write partial file: %w", &os.PathError{Op: "write", Err: diskFullErrors[0]}), 1, false, 0, 0},
+		{"other error", errors.New("connection reset"), 2, true, 4 * time.Second, 4 * time.Second},
+		{"first rate limit", rateLimited, 1, true, rateLimitBackoff / 2, rateLimitBackoff * 3 / 2},
+		{"third rate limit", rateLimited, 3, true, 2 * rateLimitBackoff, 6 * rateLimitBackoff},
+		{"capped rate limit", rateLimited, 20, true, maxRateLimitBackoff / 2, maxRateLimitBackoff * 3 / 2},
+		{"longer Retry-After", &DownloadError{Class: ClassRateLimited, Err: errors.New("429"), RetryAfter: 10 * time.Minute},
+			1, true, 10 * time.Minute, 10 * time.Minute},
+	}
+	for _, test := range tests {
+		delay, retry := retryDelay(test.err, test.attempt)
+		if retry != test.retry || delay < test.min || delay > test.max {
+			t.Errorf("%s: retryDelay = %s, %v; want %s to %s, %v", test.name, delay, retry, test.min, test.max, test.retry)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const BUTTON_SELECTOR = ".link-button.text-5xl"
+
+var (
+	// windowOpenRegex matches the URL the download button script opens
+	windowOpenRegex = regexp.MustCompile(`window\.open\(\s*["'](https?://[^"']+)["']`)
+	// directPathRegex matches any fuckingfast.co /dl/ URL embedded in the page
+	directPathRegex = regexp.MustCompile(`https?://fuckingfast\.co/dl/[^"'\s<>]+`)
+)
+
+// fuckingfastHoster downloads from fuckingfast.co
+type fuckingfastHoster struct{}
+
+func (h *fuckingfastHoster) Name() string {
+	return "fuckingfast"
+}
+
+func (h *fuckingfastHoster) Match(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "fuckingfast.co" || strings.HasSuffix(host, ".fuckingfast.co")
+}
+
+// Resolve fetches the download page and extracts the real file URL that the
+// download button would open
+func (h *fuckingfastHoster) Resolve(ctx context.Context, link string, client *http.Client) (*ResolvedLink, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch download page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("download page", resp)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read download page: %w", err)
+	}
+
+	resolved := &ResolvedLink{
+		Filename: extractFilenameFromURL(link),
+		Size:     -1,
+	}
+	if matches := windowOpenRegex.FindSubmatch(body); len(matches) >= 2 {
+		resolved.URL = string(matches[1])
+	} else if match := directPathRegex.Find(body); match != nil {
+		resolved.URL = string(match)
+	} else {
+		return nil, fmt.Errorf("no direct download link found on page")
+	}
+
+	return resolved, nil
+}
+
+// BrowserDownload performs the two-click sequence on the download button
+func (h *fuckingfastHoster) BrowserDownload(ctx context.Context, page playwright.Page, link string, timeout float64,
+	logf func(format string, args ...interface{})) (playwright.Download, error) {
+	filename := extractFilenameFromURL(link)
+
+	// Navigate to the download page.
+	logf("Navigating to download page for %s", filename)
+	_, err := page.Goto(link, playwright.PageGotoOptions{
+		WaitUntil: playwright.WaitUntilStateNetworkidle,
+		Timeout:   playwright.Float(timeout),
+	})
+	if err != nil {
+		return nil, classified(errorClass(err), fmt.Errorf("navigation failed: %w", err))
+	}
+
+	// Wait for the button to be visible.
+	button := page.Locator(BUTTON_SELECTOR)
+	if err = button.WaitFor(playwright.LocatorWaitForOptions{
+		State:   playwright.WaitForSelectorStateVisible,
+		Timeout: playwright.Float(timeout / 3), // Shorter timeout for UI elements
+	}); err != nil {
+		return nil, &DownloadError{Class: ClassButtonMissing, Err: fmt.Errorf("button not found: %w", err)}
+	}
+
+	// Perform the first click.
+	logf("Performing first click for %s", filename)
+	if err = button.Click(playwright.LocatorClickOptions{
+		Timeout: playwright.Float(timeout / 3),
+	}); err != nil {
+		return nil, fmt.Errorf("first click failed: %w", err)
+	}
+
+	// Allow some time for the page to update.
+	if !sleepContext(ctx, 2*time.Second) {
+		return nil, ctx.Err()
+	}
+	if err = button.WaitFor(playwright.LocatorWaitForOptions{
+		State:   playwright.WaitForSelectorStateVisible,
+		Timeout: playwright.Float(timeout / 3),
+	}); err != nil {
+		return nil, &DownloadError{Class: ClassButtonMissing, Err: fmt.Errorf("button not visible after first click: %w", err)}
+	}
+
+	// Use ExpectDownload to wait for the download event after the second click.
+	logf("Performing second click to start download...")
+	download, err := page.ExpectDownload(func() error {
+		return button.Click(playwright.LocatorClickOptions{
+			Timeout: playwright.Float(timeout / 3),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download event error: %w", err)
+	}
+
+	return download, nil
+}
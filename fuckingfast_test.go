@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFuckingfastMatch(t *testing.T) {
+	tests := []struct {
+		link  string
+		match bool
+	}{
+		{"https://fuckingfast.co/abc#Game.part01.rar", true},
+		{"https://FuckingFast.co/abc", true},
+		{"https://cdn.fuckingfast.co/dl/abc", true},
+		{"https://notfuckingfast.co/abc", false},
+		{"https://fuckingfast.co.example.com/abc", false},
+		{"https://datanodes.to/abc#Game.part01.rar", false},
+	}
+	hoster := &fuckingfastHoster{}
+	for _, test := range tests {
+		if got := hoster.Match(test.link); got != test.match {
+			t.Errorf("Match(%q) = %v, want %v", test.link, got, test.match)
+		}
+	}
+}
+
+func TestFuckingfastResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		page   string
+		want   string
+		class  ErrorClass
+	}{
+		{"download button script", http.StatusOK,
+			`<script>function download() { window.open("https://fuckingfast.co/dl/abc123") }</script>`,
+			"https://fuckingfast.co/dl/abc123", ClassOther},
+		{"link elsewhere in the page", http.StatusOK,
+			`<a href="https://fuckingfast.co/dl/def456">Download</a>`,
+			"https://fuckingfast.co/dl/def456", ClassOther},
+		{"no link", http.StatusOK, `<p>File not found</p>`, "", ClassOther},
+		{"removed file", http.StatusNotFound, "", "", ClassFileRemoved},
+		{"rate limited", http.StatusTooManyRequests, "", "", ClassRateLimited},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.page))
+			}))
+			defer server.Close()
+
+			resolved, err := (&fuckingfastHoster{}).Resolve(context.Background(), server.URL+"/abc#Game.part01.rar", server.Client())
+			if test.want == "" {
+				if err == nil {
+					t.Fatalf("resolved to %q, want an error", resolved.URL)
+				}
+				if class := errorClass(err); class != test.class {
+					t.Errorf("error class %s, want %s", class, test.class)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if resolved.URL != test.want || resolved.Filename != "Game.part01.rar" || resolved.Size != -1 {
+				t.Errorf("resolved %+v, want URL %q", resolved, test.want)
+			}
+		})
+	}
+}
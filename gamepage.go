@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReleaseInfo is the metadata and mirror list of a fitgirl-repacks.site game page
+type ReleaseInfo struct {
+	URL          string         `json:"url"`
+	Title        string         `json:"title"`
+	RepackSize   string         `json:"repack_size,omitempty"`
+	OriginalSize string         `json:"original_size,omitempty"`
+	Mirrors      []MirrorOption `json:"-"`
+}
+
+// MirrorOption is one entry of the "Download Mirrors" section
+type MirrorOption struct {
+	Label string
+	URL   string
+}
+
+var (
+	titleRegex        = regexp.MustCompile(`(?s)<h1[^>]*class="[^"]*entry-title[^"]*"[^>]*>(.*?)</h1>`)
+	repackSizeRegex   = regexp.MustCompile(`(?is)Repack Size:\s*<strong>(.*?)</strong>`)
+	originalSizeRegex = regexp.MustCompile(`(?is)Original Size:\s*<strong>(.*?)</strong>`)
+	mirrorsRegex      = regexp.MustCompile(`(?is)<h3[^>]*>.{0,200}?Download Mirrors.{0,200}?</h3>\s*<ul[^>]*>(.*?)</ul>`)
+	listItemRegex     = regexp.MustCompile(`(?is)<li[^>]*>(.*?)</li>`)
+	anchorRegex       = regexp.MustCompile(`(?is)<a[^>]*href=["']([^"']+)["'][^>]*>(.*?)</a>`)
+	tagRegex          = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// isPasteURL reports whether the URL points at the FitGirl paste site
+func isPasteURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.EqualFold(u.Hostname(), "paste.fitgirl-repacks.site")
+}
+
+// isGamePageURL reports whether the URL is a fitgirl-repacks.site/<game>/ page
+func isGamePageURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "fitgirl-repacks.site" && host != "www.fitgirl-repacks.site" {
+		return false
+	}
+	return strings.Trim(u.Path, "/") != ""
+}
+
+// fetchReleaseInfo downloads a game page and extracts its metadata and mirrors
+func fetchReleaseInfo(ctx context.Context, pageURL string, client *http.Client) (*ReleaseInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch game page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("game page returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read game page: %w", err)
+	}
+
+	info := parseReleaseInfo(string(body))
+	info.URL = pageURL
+	if len(info.Mirrors) == 0 {
+		return nil, fmt.Errorf("no download mirrors found on the game page")
+	}
+
+	return info, nil
+}
+
+// parseReleaseInfo extracts the title, sizes and supported download mirrors
+func parseReleaseInfo(page string) *ReleaseInfo {
+	info := &ReleaseInfo{}
+
+	if m := titleRegex.FindStringSubmatch(page); m != nil {
+		info.Title = htmlText(m[1])
+	}
+	if m := repackSizeRegex.FindStringSubmatch(page); m != nil {
+		info.RepackSize = htmlText(m[1])
+	}
+	if m := originalSizeRegex.FindStringSubmatch(page); m != nil {
+		info.OriginalSize = htmlText(m[1])
+	}
+
+	for _, section := range mirrorsRegex.FindAllStringSubmatch(page, -1) {
+		for _, item := range listItemRegex.FindAllStringSubmatch(section[1], -1) {
+			for _, anchor := range anchorRegex.FindAllStringSubmatch(item[1], -1) {
+				link := html.UnescapeString(anchor[1])
+				// Torrents and magnets are not something this tool can download
+				if !strings.HasPrefix(link, "http") || strings.HasSuffix(strings.ToLower(link), ".torrent") {
+					continue
+				}
+				if !isPasteURL(link) && !hasSupportedSource([]string{link}) {
+					continue
+				}
+
+				label := htmlText(anchor[2])
+				if label == "" {
+					label = htmlText(item[1])
+				}
+				info.Mirrors = append(info.Mirrors, MirrorOption{Label: label, URL: link})
+			}
+		}
+	}
+
+	return info
+}
+
+// htmlText strips tags and entities from an HTML fragment
+func htmlText(fragment string) string {
+	text := html.UnescapeString(tagRegex.ReplaceAllString(fragment, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// preferredMirror returns the index of the mirror to use by default: the
+// FuckingFast paste if there is one, otherwise the first paste
+func preferredMirror(mirrors []MirrorOption) int {
+	for i, mirror := range mirrors {
+		if isPasteURL(mirror.URL) && strings.Contains(strings.ToLower(mirror.Label), "fuckingfast") {
+			return i
+		}
+	}
+	for i, mirror := range mirrors {
+		if isPasteURL(mirror.URL) {
+			return i
+		}
+	}
+	return 0
+}
+
+// mergeMirrorLinks appends the links of another mirror that serve a file
+// already in links through a supported hoster, so that groupDownloadLinks
+// records them as mirrors. Files only the other mirror has are left out.
+func mergeMirrorLinks(links, mirrorLinks []string) ([]string, int) {
+	seen := make(map[string]bool)
+	filenames := make(map[string]bool)
+	for _, link := range links {
+		seen[link] = true
+		filenames[strings.ToLower(extractFilenameFromURL(link))] = true
+	}
+
+	var added int
+	for _, link := range mirrorLinks {
+		if seen[link] || !filenames[strings.ToLower(extractFilenameFromURL(link))] || !hasSupportedSource([]string{link}) {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		added++
+	}
+	return links, added
+}
+
+// promptForMirror lists the mirrors of a release and lets the user pick one
+func promptForMirror(info *ReleaseInfo) MirrorOption {
+	defaultIndex := preferredMirror(info.Mirrors)
+
+	fmt.Fprintln(console, "\nAvailable download mirrors:")
+	for i, mirror := range info.Mirrors {
+		mark := " "
+		if i == defaultIndex {
+			mark = "*"
+		}
+		fmt.Fprintf(console, "%s %d. %s (%s)\n", mark, i+1, mirror.Label, mirror.URL)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprintf(console, "\nChoose a mirror [%d]: ", defaultIndex+1)
+		if !scanner.Scan() {
+			return info.Mirrors[defaultIndex]
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			return info.Mirrors[defaultIndex]
+		}
+		num, err := strconv.Atoi(input)
+		if err == nil && num >= 1 && num <= len(info.Mirrors) {
+			return info.Mirrors[num-1]
+		}
+		fmt.Fprintf(console, "Warning: Invalid input '%s'\n", input)
+	}
+}
+
+// printReleaseInfo shows the release metadata as a header
+func printReleaseInfo(info *ReleaseInfo) {
+	fmt.Fprintln(console, info.Title)
+	if info.RepackSize != "" || info.OriginalSize != "" {
+		fmt.Fprintf(console, "Repack size: %s | Original size: %s\n", valueOr(info.RepackSize, "?"), valueOr(info.OriginalSize, "?"))
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
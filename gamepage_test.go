@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testGamePage is the relevant part of a fitgirl-repacks.site release page
+const testGamePage = `
+<h1 class="entry-title">Some Game &#8211; v1.2 + 3 DLCs</h1>
+<div class="entry-content">
+<p>Genres/Tags: Action<br>
+Original Size: <strong>45.1 GB</strong><br>
+Repack Size: <strong>from 21.3 GB [Selective Download]</strong></p>
+<h3><span style="color: #3366ff;">Download Mirrors (Direct Links)</span></h3>
+<ul>
+<li><a href="https://paste.fitgirl-repacks.site/?abc#key1">Filehoster: <strong>DataNodes</strong></a></li>
+<li><a href="https://paste.fitgirl-repacks.site/?def#key2" target="_blank">Filehoster: FuckingFast</a></li>
+<li><a href="https://fuckingfast.co/xyz#Some_Game_setup.exe">Direct setup</a></li>
+<li><a href="https://example.com/Some_Game.torrent">.torrent file only</a></li>
+<li><a href="magnet:?xt=urn:btih:123">magnet</a></li>
+</ul>
+</div>`
+
+func TestParseReleaseInfo(t *testing.T) {
+	info := parseReleaseInfo(testGamePage)
+
+	if info.Title != "Some Game – v1.2 + 3 DLCs" {
+		t.Errorf("title = %q", info.Title)
+	}
+	if info.RepackSize != "from 21.3 GB [Selective Download]" || info.OriginalSize != "45.1 GB" {
+		t.Errorf("sizes = %q, %q", info.RepackSize, info.OriginalSize)
+	}
+
+	want := []MirrorOption{
+		{Label: "Filehoster: DataNodes", URL: "https://paste.fitgirl-repacks.site/?abc#key1"},
+		{Label: "Filehoster: FuckingFast", URL: "https://paste.fitgirl-repacks.site/?def#key2"},
+		{Label: "Direct setup", URL: "https://fuckingfast.co/xyz#Some_Game_setup.exe"},
+	}
+	if !reflect.DeepEqual(info.Mirrors, want) {
+		t.Errorf("mirrors %+v, want %+v", info.Mirrors, want)
+	}
+}
+
+func TestPreferredMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirrors []MirrorOption
+		want    int
+	}{
+		{"fuckingfast paste", []MirrorOption{
+			{Label: "DataNodes", URL: "https://paste.fitgirl-repacks.site/?a"},
+			{Label: "FuckingFast", URL: "https://paste.fitgirl-repacks.site/?b"},
+		}, 1},
+		{"first paste", []MirrorOption{
+			{Label: "FuckingFast setup", URL: "https://fuckingfast.co/x#setup.exe"},
+			{Label: "DataNodes", URL: "https://paste.fitgirl-repacks.site/?a"},
+		}, 1},
+		{"no paste", []MirrorOption{
+			{Label: "Direct setup", URL: "https://fuckingfast.co/x#setup.exe"},
+		}, 0},
+	}
+	for _, test := range tests {
+		if got := preferredMirror(test.mirrors); got != test.want {
+			t.Errorf("%s: preferredMirror = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsGamePageURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://fitgirl-repacks.site/some-game/", true},
+		{"https://www.fitgirl-repacks.site/some-game", true},
+		{"https://fitgirl-repacks.site/", false},
+		{"https://paste.fitgirl-repacks.site/?abc#key", false},
+		{"https://fitgirl-repacks.site.example.com/some-game/", false},
+	}
+	for _, test := range tests {
+		if got := isGamePageURL(test.url); got != test.want {
+			t.Errorf("isGamePageURL(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+}
@@ -3,17 +3,17 @@ module fuckingloader
 go 1.23.4
 
 require (
+	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203
 	github.com/playwright-community/playwright-go v0.4902.0
 	github.com/schollz/progressbar/v3 v3.18.0
+	golang.org/x/sys v0.29.0
 )
 
 require (
 	github.com/deckarep/golang-set/v2 v2.7.0 // indirect
-	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/term v0.28.0 // indirect
 )
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// groupOrder is a way of sorting the groups in the selection menu
+type groupOrder int
+
+const (
+	orderPaste groupOrder = iota
+	orderCategory
+	orderName
+	orderSize
+	groupOrderCount
+)
+
+// String names the order in the menu header
+func (o groupOrder) String() string {
+	switch o {
+	case orderCategory:
+		return "category"
+	case orderName:
+		return "name"
+	case orderSize:
+		return "size (largest first)"
+	default:
+		return "paste order"
+	}
+}
+
+// label names the order in the menu header. Sorting by size falls back to
+// the file count when a group's size is unknown, and the label says so.
+func (o groupOrder) label(groups []FileGroup) string {
+	if o == orderSize && !sizesKnown(groups) {
+		return "file count (sizes unavailable)"
+	}
+	return o.String()
+}
+
+// categoryRank lists the categories in the order of a release: what is needed
+// to install first, extras last
+var categoryRank = map[GroupCategory]int{
+	CategoryInstaller: 0,
+	CategoryCore:      1,
+	CategorySelective: 2,
+	CategoryOptional:  3,
+	CategoryOther:     4,
+}
+
+// sortGroups sorts the groups in place. Ties keep paste order, so every order
+// is the same on every run.
+func sortGroups(groups []FileGroup, order groupOrder) {
+	bySize := sizesKnown(groups)
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := &groups[i], &groups[j]
+		switch order {
+		case orderCategory:
+			if categoryRank[a.Category] != categoryRank[b.Category] {
+				return categoryRank[a.Category] < categoryRank[b.Category]
+			}
+		case orderName:
+			if nameA, nameB := strings.ToLower(a.shortName()), strings.ToLower(b.shortName()); nameA != nameB {
+				return nameA < nameB
+			}
+		case orderSize:
+			if bySize && a.Size != b.Size {
+				return a.Size > b.Size
+			}
+			if !bySize && len(a.Files) != len(b.Files) {
+				return len(a.Files) > len(b.Files)
+			}
+		}
+		return a.position < b.position
+	})
+}
+
+// sizesKnown reports whether the size of every group is known
+func sizesKnown(groups []FileGroup) bool {
+	for _, group := range groups {
+		if group.Size <= 0 {
+			return false
+		}
+	}
+	return len(groups) > 0
+}
+
+// probeGroupSizes sets the size of every group whose files all announce one,
+// probing config.WorkerCount files at a time like the disk space check
+func probeGroupSizes(ctx context.Context, config Config, client *http.Client, groups []FileGroup) {
+	type probe struct {
+		group *FileGroup
+		link  string
+	}
+	var probes []probe
+	for i := range groups {
+		for _, link := range groups[i].Files {
+			probes = append(probes, probe{group: &groups[i], link: link})
+		}
+	}
+
+	var mutex sync.Mutex
+	unknown := make(map[*FileGroup]bool)
+	sizes := make(map[*FileGroup]int64)
+	forEachConcurrently(ctx, config.WorkerCount, len(probes), func(i int) {
+		p := probes[i]
+		size := remoteSize(ctx, client, p.group.Sources(p.link))
+		mutex.Lock()
+		defer mutex.Unlock()
+		if size < 0 {
+			unknown[p.group] = true
+		} else {
+			sizes[p.group] += size
+		}
+	})
+
+	for i := range groups {
+		group := &groups[i]
+		if unknown[group] || ctx.Err() != nil {
+			continue
+		}
+		group.Size = sizes[group]
+	}
+}
+
+// idInvalidChars are replaced by dashes when a name becomes a group ID
+var idInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// assignGroupIDs gives every group a short ID derived from its name, such as
+// "fg" or "fg-selective-english". IDs depend only on the links, so the same
+// paste yields the same IDs on every run; clashes get a numeric suffix in
+// paste order.
+func assignGroupIDs(groups []FileGroup) {
+	used := make(map[string]bool)
+	for i := range groups {
+		base := strings.Trim(idInvalidChars.ReplaceAllString(strings.ToLower(groups[i].shortName()), "-"), "-")
+		if base == "" {
+			base = "group"
+		}
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[id] = true
+		groups[i].ID = id
+	}
+}
+
+// selectGroupIDs selects exactly the groups listed by --groups: IDs separated
+// by commas or spaces, or "@file" to read them from a file with one or more
+// per line and # comments. Returns false if no listed group exists.
+func selectGroupIDs(groups []FileGroup, list string) (bool, error) {
+	ids, err := parseGroupIDs(list)
+	if err != nil {
+		return false, err
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[strings.ToLower(id)] = true
+	}
+	found := make(map[string]bool)
+	for i := range groups {
+		groups[i].Selected = wanted[groups[i].ID]
+		if groups[i].Selected {
+			found[groups[i].ID] = true
+		}
+	}
+
+	for _, id := range ids {
+		if !found[strings.ToLower(id)] {
+			available := make([]string, 0, len(groups))
+			for _, group := range groups {
+				available = append(available, group.ID)
+			}
+			log.Printf("Warning: no group with ID %q (available: %s)", id, strings.Join(available, ", "))
+		}
+	}
+	return len(found) > 0, nil
+}
+
+// parseGroupIDs splits a --groups value, reading it from a file if it starts with @
+func parseGroupIDs(list string) ([]string, error) {
+	if !strings.HasPrefix(list, "@") {
+		return strings.FieldsFunc(list, isIDSeparator), nil
+	}
+
+	file, err := os.Open(list[1:])
+	if err != nil {
+		return nil, fmt.Errorf("could not read group list: %w", err)
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		ids = append(ids, strings.FieldsFunc(line, isIDSeparator)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read group list: %w", err)
+	}
+	return ids, nil
+}
+
+// isIDSeparator reports whether r separates group IDs in a list
+func isIDSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
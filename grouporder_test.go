@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// groupIDs lists the IDs of the groups in their current order
+func groupIDs(groups []FileGroup) []string {
+	ids := make([]string, len(groups))
+	for i, group := range groups {
+		ids[i] = group.ID
+	}
+	return ids
+}
+
+func TestSortGroupsBySize(t *testing.T) {
+	groups := []FileGroup{
+		{ID: "small", Files: []string{"a", "b", "c"}, Size: 300, position: 0},
+		{ID: "large", Files: []string{"d"}, Size: 5000, position: 1},
+		{ID: "medium", Files: []string{"e", "f"}, Size: 1000, position: 2},
+	}
+	sortGroups(groups, orderSize)
+
+	if got, want := groupIDs(groups), []string{"large", "medium", "small"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	if label := orderSize.label(groups); label != "size (largest first)" {
+		t.Errorf("label = %q", label)
+	}
+}
+
+func TestSortGroupsBySizeFallsBackToFileCount(t *testing.T) {
+	groups := []FileGroup{
+		{ID: "one", Files: []string{"a"}, Size: 5000, position: 0},
+		{ID: "three", Files: []string{"b", "c", "d"}, position: 1},
+		{ID: "two", Files: []string{"e", "f"}, Size: 100, position: 2},
+	}
+	sortGroups(groups, orderSize)
+
+	if got, want := groupIDs(groups), []string{"three", "two", "one"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	if label := orderSize.label(groups); label != "file count (sizes unavailable)" {
+		t.Errorf("label = %q", label)
+	}
+}
+
+func TestProbeGroupSizes(t *testing.T) {
+	useHoster(t, &fakeHoster{resolved: ResolvedLink{URL: "https://files.test/direct", Size: 100}})
+
+	groups := groupDownloadLinks([]string{
+		"https://fake.test/a#Game.part1.rar",
+		"https://fake.test/b#Game.part2.rar",
+		"https://fake.test/c#Game.part3.rar",
+		"https://elsewhere.test/d#readme.txt",
+		"https://fake.test/e#setup.exe",
+	})
+	probeGroupSizes(context.Background(), Config{WorkerCount: 2}, http.DefaultClient, groups)
+
+	sizes := make(map[string]int64)
+	for _, group := range groups {
+		sizes[group.ID] = group.Size
+	}
+	// readme.txt has no supported hoster, so its size stays unknown
+	if want := map[string]int64{"game": 300, "readme": 0, "setup": 100}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("sizes %v, want %v", sizes, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// ResolvedLink is a hoster page link turned into a directly downloadable file
+type ResolvedLink struct {
+	URL string
+	// Filename is the name the hoster gives the file. Downloads are saved
+	// under the name in the link regardless, so that they can be found again.
+	Filename string
+	Size     int64 // -1 when unknown until the transfer starts
+}
+
+// Hoster knows how to download files from one file hosting service
+type Hoster interface {
+	// Name identifies the hoster in logs
+	Name() string
+	// Match reports whether the link belongs to this hoster
+	Match(link string) bool
+	// Resolve turns a hoster page link into a direct file URL without a browser
+	Resolve(ctx context.Context, link string, client *http.Client) (*ResolvedLink, error)
+	// BrowserDownload drives a browser page until the file download starts.
+	// It is used when Resolve fails. logf reports progress of the steps.
+	BrowserDownload(ctx context.Context, page playwright.Page, link string, timeout float64,
+		logf func(format string, args ...interface{})) (playwright.Download, error)
+}
+
+// hosters is the registry consulted for every link, in order of preference
+var hosters = []Hoster{
+	&fuckingfastHoster{},
+}
+
+// hosterFor returns the hoster that handles the link
+func hosterFor(link string) (Hoster, error) {
+	for _, hoster := range hosters {
+		if hoster.Match(link) {
+			return hoster, nil
+		}
+	}
+	return nil, fmt.Errorf("no supported hoster for %s", link)
+}
+
+// hasSupportedSource reports whether any of the links has a hoster
+func hasSupportedSource(sources []string) bool {
+	for _, source := range sources {
+		if _, err := hosterFor(source); err == nil {
+			return true
+		}
+	}
+	return false
+}
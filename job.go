@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Job is one paste (or link list) downloaded into its own directory. In batch
+// mode several jobs share the worker pool, the HTTP client and the browser.
+type Job struct {
+	// Name labels the job in the batch summary; empty for a single run
+	Name   string
+	config Config
+	state  *JobState
+	// err is set when the source could not be resolved into links
+	err error
+
+	checksums   ChecksumManifest
+	downloader  *Downloader
+	selected    []string
+	pending     []string
+	skipped     []string
+	unsupported []string
+	summary     DownloadSummary
+
+	// extractor unpacks the job's groups as they complete; nil without --extract
+	extractor     *extractor
+	extracted     int
+	repaired      int
+	extractFailed []string
+}
+
+// NewJob creates a job downloading the files of state into config.DownloadDir
+func NewJob(name string, config Config, state *JobState) *Job {
+	return &Job{Name: name, config: config, state: state}
+}
+
+// prepare sorts the selected files into those still to download, those already
+// present and those no hoster can handle
+func (j *Job) prepare(ctx context.Context, client *http.Client) error {
+	if j.Name != "" {
+		log.Printf("Preparing %s", j.Name)
+	}
+
+	// Checksums are optional; without them only sizes can be compared
+	checksums, err := loadChecksums(j.config)
+	if err != nil {
+		return err
+	}
+	j.checksums = checksums
+
+	// Files recorded as done that are still on disk need no further checks.
+	// Links that no hoster can handle fail right away instead of being retried.
+	j.selected = j.state.Links()
+	var uncheckedLinks []string
+	for _, link := range j.selected {
+		// Extracted archives count as done even if they were deleted since
+		if j.state.Extracted(link) {
+			j.skipped = append(j.skipped, link)
+			continue
+		}
+		if !hasSupportedSource(j.state.Sources(link)) {
+			j.state.SetStatus(link, StatusFailed, "no supported hoster")
+			j.unsupported = append(j.unsupported, link)
+			continue
+		}
+
+		path := filepath.Join(j.config.DownloadDir, extractFilenameFromURL(link))
+		if _, err := os.Stat(path); err == nil && j.state.Status(link) == StatusDone {
+			j.skipped = append(j.skipped, link)
+		} else {
+			uncheckedLinks = append(uncheckedLinks, link)
+		}
+	}
+
+	// Leave out files that a previous run already finished
+	log.Println("Checking for files that are already downloaded...")
+	pendingLinks, presentLinks := filterCompleted(ctx, uncheckedLinks, j.config, client, checksums, j.state)
+	for _, link := range presentLinks {
+		j.state.SetStatus(link, StatusDone, "")
+	}
+	j.pending = pendingLinks
+	j.skipped = append(j.skipped, presentLinks...)
+	if len(j.skipped) > 0 {
+		log.Printf("%d of %d files are already present", len(j.skipped), len(j.selected))
+	}
+	if len(j.unsupported) > 0 {
+		log.Printf("%d %s hosted on unsupported sites will be skipped",
+			len(j.unsupported), pluralize("file", len(j.unsupported)))
+	}
+
+	return nil
+}
+
+// runDownloadJobs downloads every file of the jobs that is not finished yet
+// with one shared worker pool, recording progress in each job's state file
+func runDownloadJobs(ctx context.Context, config Config, session *BrowserSession, limiter *RateLimiter, jobs []*Job) {
+	client := newHTTPClient(config)
+	minFree, err := validateSpaceFlags(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fail early rather than on every file when the aria2 daemon is unreachable
+	var aria2 *aria2Client
+	if config.Aria2RPC != "" {
+		aria2 = NewAria2Client(config.Aria2RPC, config.Aria2Secret, client)
+		version, err := aria2.Version(ctx)
+		if err != nil {
+			log.Fatalf("Could not reach aria2 at %s: %v", config.Aria2RPC, err)
+		}
+		log.Printf("Handing transfers to aria2 %s at %s", version, config.Aria2RPC)
+	}
+
+	total := 0
+	var tasks []downloadTask
+	for _, job := range jobs {
+		if job.err != nil {
+			continue
+		}
+		if err := job.prepare(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		total += len(job.selected)
+		for _, link := range job.pending {
+			tasks = append(tasks, downloadTask{link: link, job: job})
+		}
+	}
+
+	// The sizes serve both the space check and the overall progress; without
+	// the check only those recorded for partial downloads are known
+	estimateSizes(ctx, config, client, tasks, config.SpaceCheck != spaceCheckOff)
+
+	// Refuse or warn before a download that cannot fit on the disk
+	if err := checkDiskSpace(config, tasks, minFree); err != nil {
+		log.Fatalf("%v; free some space or run with --space-check=warn", err)
+	}
+
+	// Check for the extraction tool before anything is downloaded
+	extractor, err := newExtractor(config, jobs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Preparing to download %d files", len(tasks))
+
+	// Clear the screen before starting the download process
+	fmt.Print("\033[H\033[2J")
+
+	// Create the console logger with fixed progress bar
+	logger := NewConsoleLogger(config.LogLines, total, "Downloading files")
+	logger.SetRateLimiter(limiter)
+	logger.ExpectFiles(tasks)
+
+	// aria2 does its own transfers, so the limit is passed on as its global
+	// limit for as long as the run lasts
+	stopLimit := func() {}
+	if aria2 != nil && limiter != nil {
+		limitCtx, cancel := context.WithCancel(ctx)
+		synced := make(chan struct{})
+		go func() {
+			defer close(synced)
+			syncAria2Limit(limitCtx, aria2, limiter, logger)
+		}()
+		stopLimit = func() {
+			cancel()
+			<-synced
+		}
+	}
+
+	for _, job := range jobs {
+		if job.err != nil {
+			continue
+		}
+		job.downloader = NewDownloader(job.config, client, session, logger, job.checksums, limiter)
+		job.extractor = extractor
+
+		// Already present files count as done right away
+		if len(job.skipped) > 0 {
+			logger.UpdateProgress(len(job.skipped))
+			logger.Log("Skipped %d %s (already present)", len(job.skipped), pluralize("file", len(job.skipped)))
+		}
+		if len(job.unsupported) > 0 {
+			logger.UpdateProgress(len(job.unsupported))
+			logger.Log("Skipped %d %s (no supported hoster)", len(job.unsupported), pluralize("file", len(job.unsupported)))
+		}
+	}
+
+	// Groups are extracted as their last part arrives, while the pool goes on
+	extractor.start(ctx, jobs, logger)
+	summary := runWorkerPool(ctx, tasks, logger, config)
+	runRepairRounds(ctx, config, extractor, logger, jobs, &summary)
+	extractor.stop()
+	stopLimit()
+
+	logger.Finalize(summaryMessage(ctx, config, jobs, summary))
+}
+
+// summaryMessage describes how the run ended, with one line per job in batch mode
+func summaryMessage(ctx context.Context, config Config, jobs []*Job, summary DownloadSummary) string {
+	var lines []string
+	var pending, skipped, unsupported, unresolved, extracted, repaired int
+	var extractFailed []string
+	for _, job := range jobs {
+		if job.err != nil {
+			unresolved++
+			lines = append(lines, fmt.Sprintf("%s: could not be resolved: %v", job.Name, job.err))
+			continue
+		}
+		pending += len(job.pending)
+		skipped += len(job.skipped)
+		unsupported += len(job.unsupported)
+		extracted += job.extracted
+		repaired += job.repaired
+		for _, failure := range job.extractFailed {
+			if job.Name != "" {
+				failure = job.Name + ": " + failure
+			}
+			extractFailed = append(extractFailed, failure)
+		}
+		if job.Name != "" {
+			lines = append(lines, job.Name+": "+job.describe())
+		}
+	}
+
+	message := fmt.Sprintf("Downloads completed: %d/%d successful, %d skipped (already present)",
+		summary.Succeeded, pending, skipped)
+	if len(lines) > 0 {
+		message = strings.Join(lines, "\n") + "\n\n" + message
+	}
+	if summary.Failed > 0 {
+		message += fmt.Sprintf("\nFailed: %d %s (%s)", summary.Failed, pluralize("file", summary.Failed), summary.reasonsText())
+	}
+	if summary.FromMirror > 0 {
+		message += fmt.Sprintf("\nServed by a mirror: %d %s", summary.FromMirror, pluralize("file", summary.FromMirror))
+	}
+	if unsupported > 0 {
+		message += fmt.Sprintf("\nUnsupported hoster: %d %s", unsupported, pluralize("file", unsupported))
+	}
+	if extracted > 0 {
+		message += fmt.Sprintf("\nExtracted: %d %s", extracted, pluralize("archive", extracted))
+	}
+	if repaired > 0 {
+		message += fmt.Sprintf("\nDownloaded again: %d damaged or missing %s", repaired, pluralize("part", repaired))
+	}
+	for _, failure := range extractFailed {
+		message += "\nExtraction failed: " + failure
+	}
+	if unresolved > 0 {
+		message += fmt.Sprintf("\nNot resolved: %d %s", unresolved, pluralize("paste", unresolved))
+	}
+	if ctx.Err() != nil || summary.Aborted != nil || summary.Failed > 0 {
+		message += fmt.Sprintf("\nRun with \"resume --dir %s\" to continue", config.DownloadDir)
+	}
+	if summary.Aborted != nil {
+		message += fmt.Sprintf("\nAborted (%s): %d %s not finished; partial files are kept and resumed on the next run",
+			errorClass(summary.Aborted), summary.Cancelled, pluralize("file", summary.Cancelled))
+	} else if ctx.Err() != nil {
+		message += fmt.Sprintf("\nInterrupted: %d %s not finished; partial files are kept and resumed on the next run",
+			summary.Cancelled, pluralize("file", summary.Cancelled))
+	} else {
+		message += "\nAll operations completed."
+	}
+	return message
+}
+
+// describe summarises the outcome of one job on a single line
+func (j *Job) describe() string {
+	text := fmt.Sprintf("%d/%d successful, %d skipped", j.summary.Succeeded, len(j.pending), len(j.skipped))
+	if j.summary.Failed > 0 {
+		text += fmt.Sprintf(", %d failed", j.summary.Failed)
+	}
+	if j.summary.Cancelled > 0 {
+		text += fmt.Sprintf(", %d not finished", j.summary.Cancelled)
+	}
+	if len(j.unsupported) > 0 {
+		text += fmt.Sprintf(", %d unsupported", len(j.unsupported))
+	}
+	if j.extracted > 0 {
+		text += fmt.Sprintf(", %d extracted", j.extracted)
+	}
+	return text
+}
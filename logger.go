@@ -0,0 +1,497 @@
+package main
+
+import (
+	"container/ring"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+const (
+	// progressScale is the resolution of the overall bar (per mille)
+	progressScale = 1000
+	// redrawInterval limits how often byte updates redraw the console
+	redrawInterval = 250 * time.Millisecond
+	// speedWindow is how often per-file throughput is sampled
+	speedWindow = time.Second
+)
+
+// fileProgress tracks the transfer a single worker is currently running
+type fileProgress struct {
+	name       string
+	size       int64 // -1 when the server did not announce a size
+	received   int64
+	speed      float64 // bytes per second, smoothed
+	sampleAt   time.Time
+	sampleSize int64
+	// estimate is the size the file was expected to have before it started,
+	// and counted what the file adds to the total while it runs
+	estimate int64
+	counted  int64
+}
+
+// update recomputes the smoothed throughput once per speed window
+func (fp *fileProgress) update(now time.Time) {
+	elapsed := now.Sub(fp.sampleAt)
+	if elapsed < speedWindow {
+		return
+	}
+
+	current := float64(fp.received-fp.sampleSize) / elapsed.Seconds()
+	if fp.speed == 0 {
+		fp.speed = current
+	} else {
+		fp.speed = 0.3*current + 0.7*fp.speed
+	}
+	fp.sampleAt = now
+	fp.sampleSize = fp.received
+}
+
+// eta estimates the remaining time; zero when it cannot be estimated
+func (fp *fileProgress) eta() time.Duration {
+	if fp.size < 0 || fp.speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(fp.size-fp.received) / fp.speed * float64(time.Second))
+}
+
+// ConsoleLogger provides a way to log messages while maintaining a fixed progress bar
+type ConsoleLogger struct {
+	maxLines    int
+	messages    *ring.Ring
+	progressBar *progressbar.ProgressBar
+	mutex       sync.Mutex
+
+	totalFiles    int
+	finishedFiles int
+	totalBytes    int64 // sum of all estimated or announced file sizes
+	receivedBytes int64
+	workers       map[int]*fileProgress
+	lastRedraw    time.Time
+	limiter       *RateLimiter
+	// unsized counts the pending files whose size is not known yet
+	unsized int
+	// estimates holds the estimated size of the task each worker is on
+	estimates map[int]int64
+	// workerLimit and workerReason describe the adaptive pool size; 0 when fixed
+	workerLimit  int
+	workerReason string
+	// paused tells why new downloads are held back; empty while running
+	paused string
+	// extractions maps the groups being extracted to their progress in percent
+	extractions map[string]int
+}
+
+// NewConsoleLogger creates a new logger with fixed progress bar
+func NewConsoleLogger(maxLines int, totalFiles int, description string) *ConsoleLogger {
+	return &ConsoleLogger{
+		maxLines:    maxLines,
+		messages:    ring.New(maxLines),
+		totalFiles:  totalFiles,
+		estimates:   make(map[int]int64),
+		workers:     make(map[int]*fileProgress),
+		extractions: make(map[string]int),
+		progressBar: progressbar.NewOptions64(
+			progressScale,
+			progressbar.OptionSetDescription(description),
+			// The bar is rendered through String() as part of redraw
+			progressbar.OptionSetWriter(io.Discard),
+			progressbar.OptionSetPredictTime(false),
+			progressbar.OptionSetElapsedTime(false),
+			progressbar.OptionSetTheme(progressbar.Theme{
+				Saucer:        "=",
+				SaucerHead:    ">",
+				SaucerPadding: " ",
+				BarStart:      "[",
+				BarEnd:        "]",
+			}),
+		),
+	}
+}
+
+// SetRateLimiter shows the current rate limit in the status line
+func (cl *ConsoleLogger) SetRateLimiter(limiter *RateLimiter) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.limiter = limiter
+}
+
+// SetWorkers shows the current number of workers and why it last changed
+func (cl *ConsoleLogger) SetWorkers(count int, reason string) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.workerLimit = count
+	cl.workerReason = reason
+	cl.redraw()
+}
+
+// SetPaused shows why new downloads are held back; an empty reason clears it
+func (cl *ConsoleLogger) SetPaused(reason string) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.paused = reason
+	cl.redraw()
+}
+
+// SetExtraction shows the progress of extracting a group
+func (cl *ConsoleLogger) SetExtraction(name string, percent int) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.extractions[name] = percent
+	if time.Since(cl.lastRedraw) >= redrawInterval {
+		cl.redraw()
+	}
+}
+
+// FinishExtraction stops showing the progress of a group
+func (cl *ConsoleLogger) FinishExtraction(name string) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	delete(cl.extractions, name)
+	cl.redraw()
+}
+
+// AddFiles raises the number of files the progress bar waits for
+func (cl *ConsoleLogger) AddFiles(n int) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.totalFiles += n
+	cl.redraw()
+}
+
+// ExpectFiles adds the estimated sizes of the tasks to the total before any
+// of them starts, so that the bar and ETA cover the whole run
+func (cl *ConsoleLogger) ExpectFiles(tasks []downloadTask) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	for _, task := range tasks {
+		if task.size < 0 {
+			cl.unsized++
+		} else {
+			cl.totalBytes += task.size
+		}
+	}
+	cl.redraw()
+}
+
+// StartTask tells which task a worker takes on next, by its estimated size
+func (cl *ConsoleLogger) StartTask(workerID int, estimate int64) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.estimates[workerID] = estimate
+}
+
+// FinishTask ends the task of a worker. The estimate of a file that was not
+// downloaded is taken out of the total.
+func (cl *ConsoleLogger) FinishTask(workerID int, done bool) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	estimate := cl.estimates[workerID]
+	delete(cl.estimates, workerID)
+	if done {
+		return
+	}
+	cl.totalBytes -= max(estimate, 0)
+	if estimate < 0 {
+		cl.unsized--
+	}
+	cl.redraw()
+}
+
+// Throughput returns the combined speed of the active transfers and their number
+func (cl *ConsoleLogger) Throughput() (float64, int) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	return cl.overallSpeed(), len(cl.workers)
+}
+
+// Log adds a message to the ring buffer and redraws the console
+func (cl *ConsoleLogger) Log(format string, args ...interface{}) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	// Format the message with timestamp
+	message := fmt.Sprintf("[%s] %s",
+		time.Now().Format("15:04:05"),
+		fmt.Sprintf(format, args...))
+
+	// Add the message to the ring buffer
+	cl.messages.Value = message
+	cl.messages = cl.messages.Next()
+
+	// Redraw the console
+	cl.redraw()
+}
+
+// UpdateProgress marks n files as finished
+func (cl *ConsoleLogger) UpdateProgress(n int) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.finishedFiles += n
+	cl.redraw()
+}
+
+// StartFile begins tracking a transfer for a worker. size is -1 when unknown;
+// offset is the number of bytes already on disk from an earlier attempt.
+func (cl *ConsoleLogger) StartFile(workerID int, name string, size, offset int64) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	// Forget an earlier attempt of this worker that never finished
+	if previous, ok := cl.workers[workerID]; ok {
+		cl.dropFile(previous)
+	}
+
+	// The announced size takes the place of the estimate in the total
+	estimate := cl.estimates[workerID]
+	counted := max(estimate, 0)
+	if size > 0 {
+		counted = size
+		if estimate < 0 {
+			cl.unsized--
+		}
+	}
+	cl.totalBytes += counted - max(estimate, 0)
+	cl.receivedBytes += offset
+	cl.workers[workerID] = &fileProgress{
+		name:       name,
+		size:       size,
+		received:   offset,
+		estimate:   estimate,
+		counted:    counted,
+		sampleAt:   time.Now(),
+		sampleSize: offset,
+	}
+	cl.redraw()
+}
+
+// AddBytes records n bytes received by a worker
+func (cl *ConsoleLogger) AddBytes(workerID int, n int64) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	fp, ok := cl.workers[workerID]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	fp.received += n
+	cl.receivedBytes += n
+	fp.update(now)
+
+	if now.Sub(cl.lastRedraw) >= redrawInterval {
+		cl.redraw()
+	}
+}
+
+// FinishFile stops tracking the transfer of a worker. Bytes of a failed
+// transfer are taken out of the totals so that a retry does not count twice.
+func (cl *ConsoleLogger) FinishFile(workerID int, success bool) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	fp, ok := cl.workers[workerID]
+	if !ok {
+		return
+	}
+	if success && fp.size < 0 {
+		// The size was unknown until now
+		cl.totalBytes += fp.received - fp.counted
+		if fp.estimate < 0 {
+			cl.unsized--
+		}
+	}
+	if !success {
+		cl.dropFile(fp)
+	}
+	delete(cl.workers, workerID)
+	cl.redraw()
+}
+
+// dropFile removes the bytes of an abandoned transfer from the totals,
+// leaving the estimate of its file in place for the next attempt
+func (cl *ConsoleLogger) dropFile(fp *fileProgress) {
+	cl.totalBytes -= fp.counted - max(fp.estimate, 0)
+	if fp.size > 0 && fp.estimate < 0 {
+		cl.unsized++
+	}
+	cl.receivedBytes -= fp.received
+}
+
+// overallSpeed sums the throughput of all active transfers
+func (cl *ConsoleLogger) overallSpeed() float64 {
+	var speed float64
+	for _, fp := range cl.workers {
+		speed += fp.speed
+	}
+	return speed
+}
+
+// updateBar moves the bar to the share of the total received so far
+func (cl *ConsoleLogger) updateBar() {
+	var value int64
+	if cl.totalBytes > 0 {
+		value = cl.receivedBytes * progressScale / cl.totalBytes
+	}
+	if cl.finishedFiles < cl.totalFiles && value >= progressScale {
+		// Never show a full bar while files remain
+		value = progressScale - 1
+	}
+	cl.progressBar.Set64(value)
+}
+
+// statusLine summarizes files, bytes, throughput and ETA for the whole run
+func (cl *ConsoleLogger) statusLine() string {
+	speed := cl.overallSpeed()
+	line := fmt.Sprintf("%d/%d files | %s / %s", cl.finishedFiles, cl.totalFiles,
+		formatBytes(cl.receivedBytes), formatBytes(cl.totalBytes))
+	// Without every size the total is a lower bound, too low for an ETA
+	if cl.unsized > 0 {
+		line += fmt.Sprintf(" + %d %s of unknown size", cl.unsized, pluralize("file", cl.unsized))
+	}
+	line += fmt.Sprintf(" | %s/s", formatBytes(int64(speed)))
+	if speed > 0 && cl.unsized == 0 && cl.totalBytes > cl.receivedBytes {
+		eta := time.Duration(float64(cl.totalBytes-cl.receivedBytes) / speed * float64(time.Second))
+		line += " | ETA " + formatDuration(eta)
+	}
+	if cl.limiter != nil {
+		line += " | Limit " + cl.limiter.String()
+	}
+	if cl.workerLimit > 0 {
+		line += fmt.Sprintf(" | Workers %d (%s)", cl.workerLimit, cl.workerReason)
+	}
+	if cl.paused != "" {
+		line += " | Paused (" + cl.paused + ")"
+	}
+	return line
+}
+
+// workerLines renders one line per active transfer, ordered by worker, and
+// one per running extraction
+func (cl *ConsoleLogger) workerLines() []string {
+	ids := make([]int, 0, len(cl.workers))
+	for id := range cl.workers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		fp := cl.workers[id]
+		var progress string
+		if fp.size > 0 {
+			progress = fmt.Sprintf("%s / %s (%d%%)", formatBytes(fp.received), formatBytes(fp.size),
+				fp.received*100/fp.size)
+		} else {
+			progress = formatBytes(fp.received)
+		}
+
+		line := fmt.Sprintf("[Worker %d] %s: %s, %s/s", id, fp.name, progress, formatBytes(int64(fp.speed)))
+		if eta := fp.eta(); eta > 0 {
+			line += ", ETA " + formatDuration(eta)
+		}
+		lines = append(lines, line)
+	}
+
+	names := make([]string, 0, len(cl.extractions))
+	for name := range cl.extractions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("[Extract] %s: %d%%", name, cl.extractions[name]))
+	}
+	return lines
+}
+
+// redraw clears the console and redraws the progress bar and messages
+func (cl *ConsoleLogger) redraw() {
+	cl.lastRedraw = time.Now()
+	cl.updateBar()
+
+	// Move cursor to the top and clear everything below, since the
+	// number of worker lines changes between redraws
+	fmt.Print("\033[H")
+	fmt.Print("\033[J")
+
+	// Print progress bar, overall status and one line per active transfer
+	fmt.Println(cl.progressBar.String())
+	fmt.Println(cl.statusLine())
+	for _, line := range cl.workerLines() {
+		fmt.Println(line)
+	}
+	fmt.Println()
+
+	// Print the last n messages
+	messages := make([]string, 0, cl.maxLines)
+	cl.messages.Do(func(v interface{}) {
+		if v != nil {
+			messages = append(messages, v.(string))
+		}
+	})
+
+	// Sort messages to maintain chronological order
+	for _, msg := range messages {
+		if msg != "" {
+			fmt.Println(msg)
+		}
+	}
+}
+
+// Finalize prints a final message and resets terminal
+func (cl *ConsoleLogger) Finalize(message string) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	// Move cursor to beginning of line
+	fmt.Print("\033[H")
+
+	// Clear screen from cursor to end of screen
+	fmt.Print("\033[J")
+
+	// Print the progress bar one last time
+	if cl.finishedFiles >= cl.totalFiles {
+		cl.progressBar.Set64(progressScale)
+	}
+	fmt.Println(cl.progressBar.String())
+	fmt.Println(cl.statusLine())
+	fmt.Println()
+
+	// Print final message
+	fmt.Println(message)
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration renders a duration rounded to seconds, e.g. "1h2m3s"
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
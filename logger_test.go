@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgressTotalCoversPendingFiles(t *testing.T) {
+	logger := NewConsoleLogger(1, 3, "test")
+	logger.ExpectFiles([]downloadTask{{size: 100}, {size: 200}, {size: -1}})
+
+	check := func(step string, total int64, unsized int) {
+		t.Helper()
+		if logger.totalBytes != total || logger.unsized != unsized {
+			t.Errorf("%s: total %d with %d unsized, want %d with %d", step, logger.totalBytes, logger.unsized, total, unsized)
+		}
+	}
+	check("before the run", 300, 1)
+	if line := logger.statusLine(); !strings.Contains(line, "1 file of unknown size") {
+		t.Errorf("status line %q does not mention the unknown size", line)
+	}
+
+	// The first file is larger than estimated and needs a retry
+	logger.StartTask(1, 100)
+	logger.StartFile(1, "a", 120, 0)
+	logger.AddBytes(1, 60)
+	logger.FinishFile(1, false)
+	check("after a failed attempt", 300, 1)
+	logger.StartFile(1, "a", 120, 0)
+	logger.AddBytes(1, 120)
+	logger.FinishFile(1, true)
+	logger.FinishTask(1, true)
+	check("after the first file", 320, 1)
+
+	// The file of unknown size announces it once it starts
+	logger.StartTask(2, -1)
+	logger.StartFile(2, "c", 50, 0)
+	check("after the size is announced", 370, 0)
+	logger.FinishFile(2, false)
+	logger.FinishTask(2, false)
+	check("after the file failed", 320, 0)
+
+	if logger.receivedBytes != 120 {
+		t.Errorf("received %d bytes, want 120", logger.receivedBytes)
+	}
+}
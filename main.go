@@ -2,159 +2,119 @@ package main
 
 import (
 	"bufio"
-	"container/ring"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/eiannone/keyboard"
 	"github.com/playwright-community/playwright-go"
-	"github.com/schollz/progressbar/v3"
 )
 
+// console receives the menus and prompts. An export to stdout moves them to
+// stderr, so that they stay out of the exported list.
+var console io.Writer = os.Stdout
+
 // Config holds all program configuration
 type Config struct {
-	StartURL      string
-	WorkerCount   int
-	DownloadDir   string
-	Timeout       int
-	RetryAttempts int
-	Headless      bool
-	SkipSelection bool
-	LogLines      int
+	StartURL       string
+	WorkerCount    int
+	DownloadDir    string
+	Timeout        int
+	RetryAttempts  int
+	Headless       bool
+	SkipSelection  bool
+	LogLines       int
+	ChecksumFile   string
+	LinksFile      string
+	QueueFile      string
+	ExportFormat   string
+	ExportOutput   string
+	Aria2RPC       string
+	Aria2Secret    string
+	Segments       int
+	LimitRate      string
+	Schedule       string
+	Adaptive       bool
+	MinWorkers     int
+	MaxWorkers     int
+	SpaceCheck     string
+	MinFree        string
+	Extract        bool
+	ExtractDir     string
+	Extractor      string
+	DeleteArchives bool
+	Language       string
+	Groups         string
+	Include        stringList
+	Exclude        stringList
 }
 
 // FileGroup represents a group of related files (multiple parts of the same archive)
 type FileGroup struct {
-	Name     string
-	Files    []string
-	Selected bool
+	Name     string   `json:"name"`
+	Files    []string `json:"files"`
+	Selected bool     `json:"selected"`
+	// Mirrors holds alternative links for a part, keyed by lowercase filename
+	Mirrors map[string][]string `json:"mirrors,omitempty"`
+	// Extracted is set once the group's archive has been unpacked
+	Extracted bool `json:"extracted,omitempty"`
+	// Category tells which part of a FitGirl release the group holds
+	Category GroupCategory `json:"category,omitempty"`
+	// Language is the language of a selective language pack
+	Language string `json:"language,omitempty"`
+	// Missing names the volumes absent from the numbering of a split archive
+	Missing []string `json:"missing,omitempty"`
+	// ID identifies the group in --groups; it is the same on every run
+	ID string `json:"id,omitempty"`
+	// Size is the total size of the files in bytes; 0 while unknown
+	Size int64 `json:"size,omitempty"`
+
+	// position is the group's place in paste order
+	position int
 }
 
-// ConsoleLogger provides a way to log messages while maintaining a fixed progress bar
-type ConsoleLogger struct {
-	maxLines    int
-	messages    *ring.Ring
-	progressBar *progressbar.ProgressBar
-	mutex       sync.Mutex
+// Sources returns the link followed by its mirrors, in order of preference
+func (g *FileGroup) Sources(link string) []string {
+	return append([]string{link}, g.Mirrors[strings.ToLower(extractFilenameFromURL(link))]...)
 }
 
-// NewConsoleLogger creates a new logger with fixed progress bar
-func NewConsoleLogger(maxLines int, totalItems int64, description string) *ConsoleLogger {
-	return &ConsoleLogger{
-		maxLines: maxLines,
-		messages: ring.New(maxLines),
-		progressBar: progressbar.NewOptions64(
-			totalItems,
-			progressbar.OptionSetDescription(description),
-			progressbar.OptionSetItsString("file"),
-			progressbar.OptionShowIts(),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    ">",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-		),
+// addMirror records an alternative link for a file already in the group
+func (g *FileGroup) addMirror(filename, link string) {
+	if g.Mirrors == nil {
+		g.Mirrors = make(map[string][]string)
 	}
-}
-
-// Log adds a message to the ring buffer and redraws the console
-func (cl *ConsoleLogger) Log(format string, args ...interface{}) {
-	cl.mutex.Lock()
-	defer cl.mutex.Unlock()
-
-	// Format the message with timestamp
-	message := fmt.Sprintf("[%s] %s",
-		time.Now().Format("15:04:05"),
-		fmt.Sprintf(format, args...))
-
-	// Add the message to the ring buffer
-	cl.messages.Value = message
-	cl.messages = cl.messages.Next()
-
-	// Redraw the console
-	cl.redraw()
-}
-
-// UpdateProgress updates the progress bar value
-func (cl *ConsoleLogger) UpdateProgress(n int) {
-	cl.mutex.Lock()
-	defer cl.mutex.Unlock()
-
-	cl.progressBar.Add(n)
-	cl.redraw()
-}
-
-// redraw clears the console and redraws the progress bar and messages
-func (cl *ConsoleLogger) redraw() {
-	// Clear screen from cursor to end of screen
-	fmt.Print("\033[J")
-
-	// Move cursor to beginning of line and print progress bar
-	fmt.Print("\033[H")
-	fmt.Println(cl.progressBar.String())
-	fmt.Println()
-
-	// Print the last n messages
-	messages := make([]string, 0, cl.maxLines)
-	cl.messages.Do(func(v interface{}) {
-		if v != nil {
-			messages = append(messages, v.(string))
-		}
-	})
-
-	// Sort messages to maintain chronological order
-	for _, msg := range messages {
-		if msg != "" {
-			fmt.Println(msg)
-		}
-	}
-}
-
-// Finalize prints a final message and resets terminal
-func (cl *ConsoleLogger) Finalize(message string) {
-	cl.mutex.Lock()
-	defer cl.mutex.Unlock()
-
-	// Move cursor to beginning of line
-	fmt.Print("\033[H")
-
-	// Clear screen from cursor to end of screen
-	fmt.Print("\033[J")
-
-	// Print the progress bar one last time
-	fmt.Println(cl.progressBar.String())
-	fmt.Println()
-
-	// Print final message
-	fmt.Println(message)
+	key := strings.ToLower(filename)
+	g.Mirrors[key] = append(g.Mirrors[key], link)
 }
 
 func validateURL(url string) error {
-	if !strings.Contains(url, "paste.fitgirl-repacks.site") {
-		return fmt.Errorf("invalid URL: must contain paste.fitgirl-repacks.site")
+	if !isPasteURL(url) && !isGamePageURL(url) {
+		return fmt.Errorf("invalid URL: must be a paste.fitgirl-repacks.site link or a fitgirl-repacks.site game page")
 	}
 	return nil
 }
 
-// groupDownloadLinks organizes download links into related groups
+// groupDownloadLinks organizes download links into related groups: the
+// volumes of a split archive or numbered file set (see splitSchemes), and one
+// group for every other file. Each group is categorized by FitGirl's file
+// naming, and gaps in the numbering of a set are recorded as missing volumes.
 func groupDownloadLinks(links []string) []FileGroup {
-	// Create a map to store groups
+	// Create a map to store groups, remembering the order in which they appear
 	groups := make(map[string]*FileGroup)
+	var keys []string
+	volumesOf := make(map[string][]volume)
 
-	// Regular expression to extract the base name from filenames
-	// Matches patterns like "filename.part001.rar", "filename.part_001.rar", etc.
-	re := regexp.MustCompile(`^(.+?)\.part[_.]?(\d+)\.rar$`)
+	// Remember which group each filename went to, so the same file published
+	// on another hoster becomes a mirror rather than a duplicate part
+	groupOfFile := make(map[string]string)
 
 	for _, link := range links {
 		// Extract the actual filename part from the URL
@@ -170,74 +130,73 @@ func groupDownloadLinks(links []string) []FileGroup {
 			filename = filepath.Base(link)
 		}
 
-		// Try to match the filename to our pattern
-		// Convert to lowercase for case-insensitive matching
-		matches := re.FindStringSubmatch(strings.ToLower(filename))
-		if len(matches) >= 2 {
-			// Extract the base name (without the part number)
-			baseName := matches[1]
+		if groupName, exists := groupOfFile[strings.ToLower(filename)]; exists {
+			groups[groupName].addMirror(filename, link)
+			continue
+		}
 
-			// Create a new group if this base name hasn't been seen before
-			if _, exists := groups[baseName]; !exists {
-				groups[baseName] = &FileGroup{
-					Name:     baseName,
-					Files:    []string{},
-					Selected: true, // Default to selected
-				}
+		// Volumes of the same set share a key; any other file gets a group of its own
+		key := strings.TrimSuffix(filename, filepath.Ext(filename))
+		name := key
+		vol, isVolume := parseVolume(filename)
+		if isVolume {
+			key = vol.key
+			if name = strings.TrimRight(vol.base, "-."); name == "" {
+				name = vol.base
 			}
+		}
 
-			// Add this file to its group
-			groups[baseName].Files = append(groups[baseName].Files, link)
-		} else {
-			// For files that don't match the pattern, create a single-file group
-			baseName := strings.TrimSuffix(filename, filepath.Ext(filename))
-			if _, exists := groups[baseName]; !exists {
-				groups[baseName] = &FileGroup{
-					Name:     baseName,
-					Files:    []string{link},
-					Selected: true,
-				}
-			} else {
-				groups[baseName].Files = append(groups[baseName].Files, link)
+		// Create a new group if this key hasn't been seen before
+		if _, exists := groups[key]; !exists {
+			groups[key] = &FileGroup{
+				Name:     name,
+				Files:    []string{},
+				Selected: true, // Default to selected
+				position: len(keys),
 			}
+			keys = append(keys, key)
+		}
+
+		// Add this file to its group
+		groups[key].Files = append(groups[key].Files, link)
+		groupOfFile[strings.ToLower(filename)] = key
+		if isVolume {
+			volumesOf[key] = append(volumesOf[key], vol)
 		}
 	}
 
 	// Sort the files in each group by part number if possible
 	sortFileGroupsByPartNumber(groups)
 
-	// Convert the map to a slice for easier handling
+	// Convert the map to a slice in paste order for easier handling
 	var result []FileGroup
-	for _, group := range groups {
+	for _, key := range keys {
+		group := groups[key]
+		// Numbered volumes are archive parts; a lone .rar or .zip is not
+		numbered := false
+		for _, vol := range volumesOf[key] {
+			numbered = numbered || vol.numbered
+		}
+		group.Category, group.Language = categorize(strings.ToLower(extractFilenameFromURL(group.Files[0])), numbered)
+		group.Missing = missingVolumes(volumesOf[key])
 		result = append(result, *group)
 	}
+	assignGroupIDs(result)
 
 	return result
 }
 
-// sortFileGroupsByPartNumber sorts files in each group by their part number
+// sortFileGroupsByPartNumber sorts the volumes in each group into their order;
+// other files keep theirs
 func sortFileGroupsByPartNumber(groups map[string]*FileGroup) {
-	partRegex := regexp.MustCompile(`\.part[_.]?(\d+)\.rar$`)
-
 	for _, group := range groups {
-		// Sort the files in each group by part number
 		sort.SliceStable(group.Files, func(i, j int) bool {
-			// Extract part numbers from both filenames
-			filenameI := extractFilenameFromURL(group.Files[i])
-			filenameJ := extractFilenameFromURL(group.Files[j])
-
-			matchesI := partRegex.FindStringSubmatch(strings.ToLower(filenameI))
-			matchesJ := partRegex.FindStringSubmatch(strings.ToLower(filenameJ))
-
-			// If either doesn't match the pattern, maintain original order
-			if len(matchesI) < 2 || len(matchesJ) < 2 {
-				return i < j
+			volumeI, okI := parseVolume(extractFilenameFromURL(group.Files[i]))
+			volumeJ, okJ := parseVolume(extractFilenameFromURL(group.Files[j]))
+			if !okI || !okJ {
+				return false
 			}
-
-			// Parse part numbers and compare
-			partI, _ := strconv.Atoi(matchesI[1])
-			partJ, _ := strconv.Atoi(matchesJ[1])
-			return partI < partJ
+			return volumeI.before(volumeJ)
 		})
 	}
 }
@@ -250,8 +209,9 @@ func extractFilenameFromURL(url string) string {
 	return filepath.Base(url)
 }
 
-// interactiveSelection displays an interactive menu to select file groups
-func interactiveSelection(groups []FileGroup) []FileGroup {
+// interactiveSelection displays an interactive menu to select file groups.
+// The release metadata is shown as a header when known. Returns nil if the user cancelled.
+func interactiveSelection(config Config, groups []FileGroup, release *ReleaseInfo) []FileGroup {
 	// Make a copy of the groups to avoid modifying the original
 	selectedGroups := make([]FileGroup, len(groups))
 	copy(selectedGroups, groups)
@@ -260,19 +220,27 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 	if err := keyboard.Open(); err != nil {
 		log.Printf("Failed to open keyboard: %v", err)
 		log.Println("Falling back to non-interactive mode")
-		return promptForSelection(groups)
+		return promptForSelection(groups, release)
 	}
 	defer keyboard.Close()
 
 	currentPos := 0
+	order := orderPaste
+	// Sizes are fetched the first time the groups are sorted by them
+	sizesProbed := false
 
 	// Function to clear screen and print the current selection state
 	redrawMenu := func() {
 		// Clear screen (ANSI escape code to clear screen and move cursor to 0,0)
-		fmt.Print("\033[H\033[2J")
+		fmt.Fprint(console, "\033[H\033[2J")
 
-		fmt.Println("Navigate with ↑/↓ arrows, toggle selection with SPACE, confirm with ENTER, quit with ESC or Q")
-		fmt.Println("\nSelect which file groups to download:")
+		if release != nil {
+			printReleaseInfo(release)
+			fmt.Fprintln(console)
+		}
+
+		fmt.Fprintln(console, "Navigate with ↑/↓ arrows, toggle selection with SPACE, change the order with S, confirm with ENTER, quit with ESC or Q")
+		fmt.Fprintf(console, "\nSelect which file groups to download (sorted by %s):\n", order.label(selectedGroups))
 
 		for i, group := range selectedGroups {
 			// Show an indicator for the current cursor position
@@ -300,9 +268,13 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 				}
 			}
 
-			fmt.Printf("%s %d. [%s] %s (%d %s)\n", cursor, i+1, status, group.Name, fileCount, pluralize("file", fileCount))
+			size := ""
+			if group.Size > 0 {
+				size = ", " + formatBytes(group.Size)
+			}
+			fmt.Fprintf(console, "%s %d. [%s] %s (%d %s%s)\n", cursor, i+1, status, group.menuLabel(), fileCount, pluralize("file", fileCount), size)
 			if i == currentPos {
-				fmt.Printf("      Sample: %s\n", sampleName)
+				fmt.Fprintf(console, "      ID: %s | Sample: %s\n", group.ID, sampleName)
 			}
 		}
 
@@ -316,7 +288,7 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 			}
 		}
 
-		fmt.Printf("\nCurrently selected: %d of %d groups (%d total files)\n",
+		fmt.Fprintf(console, "\nCurrently selected: %d of %d groups (%d total files)\n",
 			selectedCount, len(selectedGroups), totalFiles)
 	}
 
@@ -356,14 +328,14 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 			}
 
 			if selectedCount == 0 {
-				fmt.Println("\nWarning: No groups selected. Please select at least one group.")
+				fmt.Fprintln(console, "\nWarning: No groups selected. Please select at least one group.")
 				time.Sleep(2 * time.Second)
 				redrawMenu()
 				continue
 			}
 
 			// Final confirmation
-			fmt.Print("\nConfirm selection? (Y/n): ")
+			fmt.Fprint(console, "\nConfirm selection? (Y/n): ")
 			char, _, _ = keyboard.GetKey()
 			if char == 'n' || char == 'N' {
 				redrawMenu()
@@ -371,15 +343,31 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 			}
 
 			return selectedGroups
-		case keyboard.KeyEsc:
-			// Exit
-			fmt.Println("\nOperation cancelled by user.")
-			os.Exit(0)
+		case keyboard.KeyEsc, keyboard.KeyCtrlC:
+			// Exit; the terminal is in raw mode, so Ctrl+C arrives as a key
+			fmt.Fprintln(console, "\nOperation cancelled by user.")
+			return nil
 		default:
 			// Handle regular keys
 			if char == 'q' || char == 'Q' {
-				fmt.Println("\nOperation cancelled by user.")
-				os.Exit(0)
+				fmt.Fprintln(console, "\nOperation cancelled by user.")
+				return nil
+			}
+			if char == 's' || char == 'S' {
+				// Re-sort, keeping the cursor on the same group
+				currentID := selectedGroups[currentPos].ID
+				order = (order + 1) % groupOrderCount
+				if order == orderSize && !sizesProbed {
+					fmt.Fprintln(console, "\nFetching file sizes...")
+					probeGroupSizes(context.Background(), config, newHTTPClient(config), selectedGroups)
+					sizesProbed = true
+				}
+				sortGroups(selectedGroups, order)
+				for i, group := range selectedGroups {
+					if group.ID == currentID {
+						currentPos = i
+					}
+				}
 			}
 		}
 
@@ -392,11 +380,17 @@ func interactiveSelection(groups []FileGroup) []FileGroup {
 }
 
 // promptForSelection displays file groups and allows user to select which to download
-// This is kept as a fallback in case keyboard control is not available
-func promptForSelection(groups []FileGroup) []FileGroup {
+// This is kept as a fallback in case keyboard control is not available.
+// Returns nil if nothing was selected.
+func promptForSelection(groups []FileGroup, release *ReleaseInfo) []FileGroup {
 	scanner := bufio.NewScanner(os.Stdin)
 
-	fmt.Println("\nThe following file groups were found. Enter the numbers of groups you want to EXCLUDE, separated by space:")
+	if release != nil {
+		fmt.Fprintln(console)
+		printReleaseInfo(release)
+	}
+
+	fmt.Fprintln(console, "\nThe following file groups were found. Enter the numbers of groups you want to toggle, separated by space:")
 	for i, group := range groups {
 		fileCount := len(group.Files)
 
@@ -411,33 +405,33 @@ func promptForSelection(groups []FileGroup) []FileGroup {
 			}
 		}
 
-		fmt.Printf("%d. [X] %s (%d %s)\n", i+1, group.Name, fileCount, pluralize("file", fileCount))
-		fmt.Printf("   Sample: %s\n", sampleName)
+		mark := " "
+		if group.Selected {
+			mark = "X"
+		}
+		fmt.Fprintf(console, "%d. [%s] %s (%d %s)\n", i+1, mark, group.menuLabel(), fileCount, pluralize("file", fileCount))
+		fmt.Fprintf(console, "   ID: %s | Sample: %s\n", group.ID, sampleName)
 	}
 
-	fmt.Print("\nEnter numbers to exclude (or press Enter to download all): ")
+	fmt.Fprint(console, "\nEnter numbers to toggle (or press Enter to keep this selection): ")
 	scanner.Scan()
 	input := scanner.Text()
 
-	if input == "" {
-		return groups // No changes, download all
-	}
-
 	// Parse the numbers entered by the user
-	excludeNumbers := strings.Fields(input)
-	for _, numStr := range excludeNumbers {
+	toggleNumbers := strings.Fields(input)
+	for _, numStr := range toggleNumbers {
 		num, err := strconv.Atoi(numStr)
 		if err != nil || num < 1 || num > len(groups) {
-			fmt.Printf("Warning: Invalid input '%s' ignored\n", numStr)
+			fmt.Fprintf(console, "Warning: Invalid input '%s' ignored\n", numStr)
 			continue
 		}
 
-		// Unselect the group (zero-indexed in the array, but 1-indexed in the display)
-		groups[num-1].Selected = false
+		// Toggle the group (zero-indexed in the array, but 1-indexed in the display)
+		groups[num-1].Selected = !groups[num-1].Selected
 	}
 
 	// Display the final selection
-	fmt.Println("\nSelected groups for download:")
+	fmt.Fprintln(console, "\nSelected groups for download:")
 	selectedCount := 0
 	totalFiles := 0
 	for i, group := range groups {
@@ -447,16 +441,16 @@ func promptForSelection(groups []FileGroup) []FileGroup {
 			selectedCount++
 			totalFiles += len(group.Files)
 		}
-		fmt.Printf("%d. [%s] %s (%d files)\n", i+1, mark, group.Name, len(group.Files))
+		fmt.Fprintf(console, "%d. [%s] %s (%d files)\n", i+1, mark, group.menuLabel(), len(group.Files))
 	}
 
 	if selectedCount == 0 {
-		fmt.Println("Warning: No groups selected. Exiting.")
-		os.Exit(0)
+		fmt.Fprintln(console, "Warning: No groups selected. Exiting.")
+		return nil
 	}
 
-	fmt.Printf("\nWill download %d of %d groups (%d total files).\n", selectedCount, len(groups), totalFiles)
-	fmt.Print("Press Enter to continue or Ctrl+C to abort... ")
+	fmt.Fprintf(console, "\nWill download %d of %d groups (%d total files).\n", selectedCount, len(groups), totalFiles)
+	fmt.Fprint(console, "Press Enter to continue or Ctrl+C to abort... ")
 	scanner.Scan() // Wait for user confirmation
 
 	return groups
@@ -474,249 +468,280 @@ func main() {
 	config := Config{}
 
 	flag.IntVar(&config.WorkerCount, "workers", 3, "Number of concurrent download workers")
+	flag.BoolVar(&config.Adaptive, "adaptive", false, "Adjust the number of workers to the hoster's throttling, starting at --workers")
+	flag.IntVar(&config.MinWorkers, "min-workers", 1, "Fewest workers in adaptive mode")
+	flag.IntVar(&config.MaxWorkers, "max-workers", 8, "Most workers in adaptive mode")
 	flag.StringVar(&config.DownloadDir, "dir", "downloads", "Directory to save downloads")
 	flag.IntVar(&config.Timeout, "timeout", 30, "Timeout in seconds for network operations")
 	flag.IntVar(&config.RetryAttempts, "retry", 3, "Number of retry attempts for failed downloads")
+	flag.StringVar(&config.LimitRate, "limit-rate", "", "Total download rate limit shared by all workers, e.g. 500K or 2M (default unlimited)")
+	flag.StringVar(&config.Schedule, "schedule", "", "Time-of-day rate limits overriding --limit-rate, e.g. 01:00-07:00=0,12:00-13:00=1M")
+	flag.StringVar(&config.SpaceCheck, "space-check", "warn", "What to do when the pending files do not fit on the disk: warn, refuse or off")
+	flag.StringVar(&config.MinFree, "min-free", "1G", "Free space to keep on the disk; new downloads pause below it (0 to disable)")
+	flag.IntVar(&config.Segments, "segments", 1, "Number of parallel connections per file (ranges of one part)")
 	flag.BoolVar(&config.Headless, "headless", true, "Run browser in headless mode")
-	flag.BoolVar(&config.SkipSelection, "skip-selection", false, "Skip file group selection and download all files")
+	flag.BoolVar(&config.SkipSelection, "skip-selection", false, "Skip file group selection and download every group that is selected by default")
+	flag.StringVar(&config.Groups, "groups", "", "Select exactly these group IDs without the menu, comma-separated, or @file to read them from a file")
+	flag.Var(&config.Include, "include", "Keep only the groups whose ID, name or file names match this glob, or regular expression with a re: prefix (repeatable)")
+	flag.Var(&config.Exclude, "exclude", "Deselect the groups whose ID, name or file names match this glob, or regular expression with a re: prefix (repeatable)")
+	flag.StringVar(&config.Language, "language", "english", "Comma-separated languages whose FitGirl language packs are selected by default (empty for all)")
 	flag.IntVar(&config.LogLines, "log-lines", 3, "Number of log lines to display during download")
+	flag.BoolVar(&config.Extract, "extract", false, "Extract each RAR group as soon as all its parts are downloaded")
+	flag.StringVar(&config.ExtractDir, "extract-dir", "", "Directory to extract into (default: --dir; one subdirectory per game in batch mode)")
+	flag.StringVar(&config.Extractor, "extractor", "", "unrar or 7z executable used by --extract (default: the first of unrar, 7z, 7zz in PATH)")
+	flag.BoolVar(&config.DeleteArchives, "delete-archives", false, "Delete the archive parts after a successful extraction")
+	flag.StringVar(&config.ChecksumFile, "md5", "", "MD5 checksum manifest to verify downloads against (default: *.md5 in --dir or its MD5 folder)")
+	flag.StringVar(&config.LinksFile, "links-file", "", "Read download links from a file (- for stdin) instead of a paste")
+	flag.StringVar(&config.QueueFile, "queue", "", "Read start URLs to download one after another from a file (- for stdin)")
+	flag.StringVar(&config.ExportFormat, "format", "aria2", "Export format: aria2, crawljob, txt or csv")
+	flag.StringVar(&config.ExportOutput, "output", "-", "File to write the export to (- for stdout)")
+	flag.StringVar(&config.Aria2RPC, "aria2-rpc", "", "Hand transfers to a running aria2 daemon at this JSON-RPC URL (e.g. http://localhost:6800/jsonrpc)")
+	flag.StringVar(&config.Aria2Secret, "aria2-secret", "", "RPC secret token of the aria2 daemon")
 
 	flag.Parse()
 
 	// Check if a URL was provided
 	args := flag.Args()
-	if len(args) < 1 {
-		log.Fatal("Usage: program [flags] <starturl>\nRun with -h for help")
+	if len(args) < 1 && config.LinksFile == "" && config.QueueFile == "" {
+		log.Fatal("Usage: program [flags] <starturl> [<starturl>...]\n       program [flags] --queue <file|->\n       program [flags] --links-file <file|->\n       program [flags] export <starturl>...\n       program [flags] verify\n       program [flags] resume\nRun with -h for help")
 	}
 
-	config.StartURL = args[0]
+	if config.Adaptive && (config.MinWorkers < 1 || config.MaxWorkers < config.MinWorkers) {
+		log.Fatal("--min-workers must be at least 1 and not above --max-workers")
+	}
 
-	// Create downloads directory if it doesn't exist
-	if err := os.MkdirAll(config.DownloadDir, 0755); err != nil {
-		log.Fatalf("Failed to create downloads directory: %v", err)
+	if config.DeleteArchives && !config.Extract {
+		log.Fatal("--delete-archives requires --extract")
 	}
 
-	// Validate the URL
-	if err := validateURL(config.StartURL); err != nil {
+	// One limiter is shared by every transfer of the run
+	limiter, err := NewRateLimiter(config.LimitRate, config.Schedule)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("Starting download from: %s", config.StartURL)
-	log.Printf("Download directory: %s", config.DownloadDir)
-	log.Printf("Using %d workers", config.WorkerCount)
+	// Ctrl+C cancels this context; deferred cleanup below still runs
+	ctx, cancel := withInterruptHandling(context.Background())
+	defer cancel()
 
-	// Install Playwright if needed
-	if err := playwright.Install(); err != nil {
-		log.Fatalf("Failed to install Playwright driver: %v", err)
-	}
+	// The browser is only started when paste decryption or a direct download fails
+	session := NewBrowserSession(config.Headless)
+	defer session.Close()
 
-	// Start Playwright and launch the browser
-	pw, err := playwright.Run()
-	if err != nil {
-		log.Fatalf("Could not start Playwright: %v", err)
+	// Subcommands accept flags after their name as well
+	var command string
+	if len(args) > 0 {
+		command = args[0]
 	}
-
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(config.Headless),
-	})
-	if err != nil {
-		log.Fatalf("Could not launch browser: %v", err)
+	exporting := false
+	switch command {
+	case "export":
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		args = flag.Args()
+		exporting = true
+	case "verify":
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		failed, err := runVerify(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	case "resume":
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		jobs, err := loadJobs(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, job := range jobs {
+			log.Printf("Resuming download from: %s", job.state.SourceURL)
+		}
+		runDownloadJobs(ctx, config, session, limiter, jobs)
+		return
 	}
 
-	defer func() {
-		if err := browser.Close(); err != nil {
-			log.Printf("Could not close browser: %v", err)
+	// Every start URL on the command line or in the queue file is one paste
+	sources := args
+	if config.QueueFile != "" {
+		queued, err := readURLList(config.QueueFile, "queue file")
+		if err != nil {
+			log.Fatal(err)
 		}
-		if err := pw.Stop(); err != nil {
-			log.Printf("Could not stop Playwright: %v", err)
+		sources = append(sources, queued...)
+	}
+	if config.LinksFile != "" && len(sources) > 0 {
+		log.Fatal("Start URLs cannot be combined with --links-file")
+	}
+	for _, source := range sources {
+		// Validate the URL
+		if err := validateURL(source); err != nil {
+			log.Fatal(err)
 		}
-	}()
-
-	// Extract download links
-	log.Println("Extracting download links...")
-	links, err := extractUrls(config.StartURL, browser)
-	if err != nil {
-		log.Fatalf("Failed to extract URLs: %v", err)
 	}
-	log.Printf("Found %d links to download", len(links))
 
-	// Group the links by their base names
-	groups := groupDownloadLinks(links)
-	log.Printf("Organized into %d distinct file groups", len(groups))
+	// Export hands the resolved links to another downloader instead
+	if exporting {
+		if len(sources) == 0 && config.LinksFile == "" {
+			log.Fatal("export needs a start URL, --queue or --links-file")
+		}
+		if err := runExport(ctx, config, session, sources); err != nil {
+			if ctx.Err() != nil {
+				log.Println("Operation cancelled by user.")
+				return
+			}
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Allow user to select which groups to download (unless skipped)
-	if !config.SkipSelection {
-		groups = interactiveSelection(groups)
+	// Create downloads directory if it doesn't exist
+	if err := os.MkdirAll(config.DownloadDir, 0755); err != nil {
+		log.Fatalf("Failed to create downloads directory: %v", err)
 	}
 
-	// Flatten the selected groups back into a list of links to download
-	var selectedLinks []string
-	for _, group := range groups {
-		if group.Selected {
-			selectedLinks = append(selectedLinks, group.Files...)
+	if config.LinksFile != "" {
+		config.StartURL = config.LinksFile
+	} else if len(sources) == 1 {
+		config.StartURL = sources[0]
+	}
+	if config.StartURL != "" {
+		log.Printf("Starting download from: %s", config.StartURL)
+	} else {
+		log.Printf("Starting batch of %d pastes", len(sources))
+	}
+	log.Printf("Download directory: %s", config.DownloadDir)
+	if config.Adaptive {
+		log.Printf("Using %d-%d workers, starting at %d", config.MinWorkers, config.MaxWorkers, config.WorkerCount)
+	} else {
+		log.Printf("Using %d workers", config.WorkerCount)
+	}
+
+	// Several pastes each get a subdirectory and share one worker pool
+	if config.StartURL == "" {
+		jobs := resolveBatch(ctx, config, session, sources)
+		if ctx.Err() != nil {
+			log.Println("Operation cancelled by user.")
+			return
+		}
+		if len(jobs) == 0 {
+			log.Println("No files selected for download. Exiting.")
+			return
 		}
+		runDownloadJobs(ctx, config, session, limiter, jobs)
+		return
 	}
 
-	if len(selectedLinks) == 0 {
-		log.Println("No files selected for download. Exiting.")
+	var links []string
+	var release *ReleaseInfo
+	if config.LinksFile != "" {
+		// A prepared link list needs no paste site at all
+		links, err = readURLList(config.LinksFile, "links file")
+	} else {
+		links, release, err = resolveLinks(ctx, config.StartURL, config, session)
+	}
+	if ctx.Err() != nil {
+		log.Println("Operation cancelled by user.")
 		return
 	}
-
-	log.Printf("Preparing to download %d files", len(selectedLinks))
-
-	// Clear the screen before starting the download process
-	fmt.Print("\033[H\033[2J")
-
-	// Create the console logger with fixed progress bar
-	logger := NewConsoleLogger(config.LogLines, int64(len(selectedLinks)), "Downloading files")
-
-	// Create a channel for the URLs
-	jobs := make(chan string, len(selectedLinks))
-	results := make(chan bool, len(selectedLinks))
-	var wg sync.WaitGroup
-
-	// Launch worker pool
-	for i := 0; i < config.WorkerCount; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for url := range jobs {
-				success := false
-				for attempt := 1; attempt <= config.RetryAttempts; attempt++ {
-					if attempt > 1 {
-						logger.Log("[Worker %d] Retry attempt %d/%d for %s",
-							workerID, attempt, config.RetryAttempts, url)
-					}
-
-					if downloadRarWithLogger(url, browser, config, logger, workerID) {
-						success = true
-						break
-					}
-
-					// Wait before retrying
-					if attempt < config.RetryAttempts {
-						time.Sleep(time.Duration(attempt) * 2 * time.Second)
-					}
-				}
-
-				results <- success
-				logger.UpdateProgress(1)
-			}
-		}(i + 1)
+	if err != nil {
+		log.Printf("Failed to extract URLs: %v", err)
+		// os.Exit skips the deferred cleanup, so the browser is closed first
+		session.Close()
+		os.Exit(1)
 	}
 
-	// Feed job channel with URLs
-	for _, link := range selectedLinks {
-		jobs <- link
+	job, err := newSourceJob(config, config.StartURL, links, release, false, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if job == nil {
+		log.Println("No files selected for download. Exiting.")
+		return
 	}
-	close(jobs)
-
-	// Collect results
-	successCount := 0
-	go func() {
-		for success := range results {
-			if success {
-				successCount++
-			}
-		}
-	}()
-
-	// Wait for workers to finish
-	wg.Wait()
-	close(results)
 
-	// Show the final results
-	logger.Finalize(fmt.Sprintf("Downloads completed: %d/%d successful\nAll operations completed.",
-		successCount, len(selectedLinks)))
+	runDownloadJobs(ctx, config, session, limiter, []*Job{job})
 }
 
-const BUTTON_SELECTOR = ".link-button.text-5xl"
+// resolveLinks turns a start URL into download links. A game page lists
+// several mirrors; one is picked as the source, and the links of the others
+// are added as mirrors of the files they have in common with it.
+func resolveLinks(ctx context.Context, startURL string, config Config, session *BrowserSession) ([]string, *ReleaseInfo, error) {
+	if !isGamePageURL(startURL) {
+		links, err := extractLinks(ctx, startURL, config, session)
+		return links, nil, err
+	}
 
-// downloadRar navigates to a URL and downloads the matching RAR file.
-// Returns true if download was successful, false otherwise.
-func downloadRar(link string, browser playwright.Browser, config Config) bool {
-	// Create a new page for the download.
-	page, err := browser.NewPage(playwright.BrowserNewPageOptions{
-		AcceptDownloads: playwright.Bool(true),
-	})
+	log.Println("Reading game page...")
+	release, err := fetchReleaseInfo(ctx, startURL, newHTTPClient(config))
 	if err != nil {
-		log.Printf("[%s] Failed to create page: %v", link, err)
-		return false
+		return nil, nil, fmt.Errorf("failed to read game page: %w", err)
 	}
-	defer page.Close()
 
-	// Set a custom timeout based on config
-	timeout := float64(config.Timeout * 1000) // Convert seconds to ms
+	printReleaseInfo(release)
+	var mirror MirrorOption
+	if config.SkipSelection {
+		mirror = release.Mirrors[preferredMirror(release.Mirrors)]
+	} else {
+		mirror = promptForMirror(release)
+	}
+	log.Printf("Using mirror: %s", mirror.Label)
 
-	// Navigate to the download page.
-	_, err = page.Goto(link, playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateNetworkidle,
-		Timeout:   playwright.Float(timeout),
-	})
+	links, err := extractLinks(ctx, mirror.URL, config, session)
 	if err != nil {
-		log.Printf("[%s] Navigation failed: %v", link, err)
-		return false
-	}
-
-	// Wait for the button to be visible.
-	button := page.Locator(BUTTON_SELECTOR)
-	if err = button.WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(timeout / 3), // Shorter timeout for UI elements
-	}); err != nil {
-		log.Printf("[%s] Button not found: %v", link, err)
-		return false
-	}
-
-	// Perform the first click.
-	log.Printf("[%s] Performing first click...", link)
-	if err = button.Click(playwright.LocatorClickOptions{
-		Timeout: playwright.Float(timeout / 3),
-	}); err != nil {
-		log.Printf("[%s] First click failed: %v", link, err)
-		return false
-	}
-
-	// Allow some time for the page to update.
-	time.Sleep(2 * time.Second)
-	if err = button.WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(timeout / 3),
-	}); err != nil {
-		log.Printf("[%s] Button not visible after first click: %v", link, err)
-		return false
-	}
-
-	// Use ExpectDownload to wait for the download event after the second click.
-	log.Printf("[%s] Performing second click to start download...", link)
-	download, err := page.ExpectDownload(func() error {
-		return button.Click(playwright.LocatorClickOptions{
-			Timeout: playwright.Float(timeout / 3),
-		})
-	})
-	if err != nil {
-		log.Printf("[%s] Download event error: %v", link, err)
-		return false
+		return nil, release, err
 	}
 
-	// Retrieve the suggested filename.
-	suggestedName := download.SuggestedFilename()
-
-	downloadPath := filepath.Join(config.DownloadDir, suggestedName)
-	log.Printf("[%s] Starting download of: %s", link, suggestedName)
+	// The other mirrors become fallbacks for the files they share with this one
+	for _, other := range release.Mirrors {
+		if other.URL == mirror.URL || ctx.Err() != nil {
+			continue
+		}
+		otherLinks, err := extractLinks(ctx, other.URL, config, session)
+		if err != nil {
+			log.Printf("Could not read mirror %s: %v", other.Label, err)
+			continue
+		}
+		var added int
+		links, added = mergeMirrorLinks(links, otherLinks)
+		log.Printf("Mirror %s: %d fallback links", other.Label, added)
+	}
+	return links, release, nil
+}
 
-	// Save the downloaded file.
-	if err = download.SaveAs(downloadPath); err != nil {
-		log.Printf("[%s] Failed to save download: %v", link, err)
-		return false
+// extractLinks returns the download links behind a source: the decrypted
+// contents of a paste, or the link itself when it points straight at a hoster
+func extractLinks(ctx context.Context, sourceURL string, config Config, session *BrowserSession) ([]string, error) {
+	if !isPasteURL(sourceURL) {
+		return []string{sourceURL}, nil
 	}
 
-	log.Printf("[%s] Download completed: %s", link, downloadPath)
-	return true
+	// Extract download links by decrypting the paste directly
+	log.Println("Extracting download links...")
+	links, err := fetchPasteLinks(ctx, sourceURL, time.Duration(config.Timeout)*time.Second)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Could not decrypt paste directly: %v", err)
+		log.Println("Falling back to browser extraction...")
+		var browser playwright.Browser
+		if browser, err = session.Browser(); err == nil {
+			links, err = extractUrls(ctx, sourceURL, browser)
+		}
+	}
+	return links, err
 }
 
 // extractUrls extracts URLs from the given page.
-func extractUrls(url string, browser playwright.Browser) ([]string, error) {
+func extractUrls(ctx context.Context, url string, browser playwright.Browser) ([]string, error) {
 	var links []string
 
 	page, err := browser.NewPage()
@@ -724,6 +749,7 @@ func extractUrls(url string, browser playwright.Browser) ([]string, error) {
 		return nil, fmt.Errorf("could not create page: %w", err)
 	}
 	defer page.Close()
+	defer closeOnCancel(ctx, page)()
 
 	_, err = page.Goto(url, playwright.PageGotoOptions{
 		WaitUntil: playwright.WaitUntilStateNetworkidle,
@@ -754,90 +780,3 @@ func extractUrls(url string, browser playwright.Browser) ([]string, error) {
 
 	return links, nil
 }
-
-// downloadRarWithLogger navigates to a URL and downloads the matching RAR file.
-// Uses the ConsoleLogger for output. Returns true if download was successful, false otherwise.
-func downloadRarWithLogger(link string, browser playwright.Browser, config Config, logger *ConsoleLogger, workerID int) bool {
-	// Create a new page for the download.
-	page, err := browser.NewPage(playwright.BrowserNewPageOptions{
-		AcceptDownloads: playwright.Bool(true),
-	})
-	if err != nil {
-		logger.Log("[Worker %d] Failed to create page: %v", workerID, err)
-		return false
-	}
-	defer page.Close()
-
-	// Set a custom timeout based on config
-	timeout := float64(config.Timeout * 1000) // Convert seconds to ms
-
-	// Extract the filename from the link for logging
-	filename := extractFilenameFromURL(link)
-
-	// Navigate to the download page.
-	logger.Log("[Worker %d] Navigating to download page for %s", workerID, filename)
-	_, err = page.Goto(link, playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateNetworkidle,
-		Timeout:   playwright.Float(timeout),
-	})
-	if err != nil {
-		logger.Log("[Worker %d] Navigation failed: %v", workerID, err)
-		return false
-	}
-
-	// Wait for the button to be visible.
-	button := page.Locator(BUTTON_SELECTOR)
-	if err = button.WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(timeout / 3), // Shorter timeout for UI elements
-	}); err != nil {
-		logger.Log("[Worker %d] Button not found: %v", workerID, err)
-		return false
-	}
-
-	// Perform the first click.
-	logger.Log("[Worker %d] Performing first click for %s", workerID, filename)
-	if err = button.Click(playwright.LocatorClickOptions{
-		Timeout: playwright.Float(timeout / 3),
-	}); err != nil {
-		logger.Log("[Worker %d] First click failed: %v", workerID, err)
-		return false
-	}
-
-	// Allow some time for the page to update.
-	time.Sleep(2 * time.Second)
-	if err = button.WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(timeout / 3),
-	}); err != nil {
-		logger.Log("[Worker %d] Button not visible after first click: %v", workerID, err)
-		return false
-	}
-
-	// Use ExpectDownload to wait for the download event after the second click.
-	logger.Log("[Worker %d] Performing second click to start download...", workerID)
-	download, err := page.ExpectDownload(func() error {
-		return button.Click(playwright.LocatorClickOptions{
-			Timeout: playwright.Float(timeout / 3),
-		})
-	})
-	if err != nil {
-		logger.Log("[Worker %d] Download event error: %v", workerID, err)
-		return false
-	}
-
-	// Retrieve the suggested filename.
-	suggestedName := download.SuggestedFilename()
-
-	downloadPath := filepath.Join(config.DownloadDir, suggestedName)
-	logger.Log("[Worker %d] Starting download of: %s", workerID, suggestedName)
-
-	// Save the downloaded file.
-	if err = download.SaveAs(downloadPath); err != nil {
-		logger.Log("[Worker %d] Failed to save download: %v", workerID, err)
-		return false
-	}
-
-	logger.Log("[Worker %d] Download completed: %s", workerID, suggestedName)
-	return true
-}
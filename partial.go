@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// partialSuffix is appended to files that are still being downloaded
+	partialSuffix = ".part"
+	// sidecarSuffix is appended to the sidecar describing a partial file
+	sidecarSuffix = ".part.json"
+	// checkpointInterval is how many bytes are written between sidecar updates
+	checkpointInterval = 8 << 20
+)
+
+// partialState is stored next to a .part file so an interrupted download can
+// continue with a Range request instead of starting over
+type partialState struct {
+	SourceURL    string `json:"source_url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	TotalSize    int64  `json:"total_size"`
+	BytesWritten int64  `json:"bytes_written"`
+	// Segments is set when the file is fetched over several connections
+	Segments []segment `json:"segments,omitempty"`
+}
+
+// loadPartialState reads a sidecar file. A missing sidecar is not an error.
+func loadPartialState(path string) (*partialState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state partialState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("corrupt sidecar %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// save writes the sidecar atomically so a crash never leaves it half-written
+func (ps *partialState) save(path string) error {
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// validator returns the value to send in If-Range, preferring the ETag
+func (ps *partialState) validator() string {
+	if ps.ETag != "" && !strings.HasPrefix(ps.ETag, "W/") {
+		return ps.ETag
+	}
+	return ps.LastModified
+}
+
+// checkpointWriter writes to a partial file and periodically records progress
+// in its sidecar
+type checkpointWriter struct {
+	file        *os.File
+	state       *partialState
+	sidecarPath string
+	sinceSave   int64
+}
+
+func (cw *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := cw.file.Write(p)
+	cw.state.BytesWritten += int64(n)
+	cw.sinceSave += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	if cw.sinceSave >= checkpointInterval {
+		cw.sinceSave = 0
+		if err := cw.state.save(cw.sidecarPath); err != nil {
+			return n, fmt.Errorf("could not update sidecar: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// parseUnsatisfiedRange parses the "bytes */total" of a 416 reply
+func parseUnsatisfiedRange(header string) (int64, error) {
+	totalPart, ok := strings.CutPrefix(header, "bytes */")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	total, err := strconv.ParseInt(totalPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	return total, nil
+}
+
+// parseContentRange parses "bytes start-end/total"; total is -1 when unknown
+func parseContentRange(header string) (start, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	startPart, _, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	if start, err = strconv.ParseInt(startPart, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+		}
+	}
+	return start, total, nil
+}
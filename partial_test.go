@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header       string
+		start, total int64
+		valid        bool
+	}{
+		{"bytes 0-99/1000", 0, 1000, true},
+		{"bytes 300-999/1000", 300, 1000, true},
+		{"bytes 300-999/*", 300, -1, true},
+		{"bytes */1000", 0, 0, false},
+		{"300-999/1000", 0, 0, false},
+		{"bytes x-999/1000", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, total, err := parseContentRange(test.header)
+		if (err == nil) != test.valid || (test.valid && (start != test.start || total != test.total)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, valid %v",
+				test.header, start, total, err, test.start, test.total, test.valid)
+		}
+	}
+}
+
+func TestParseUnsatisfiedRange(t *testing.T) {
+	tests := []struct {
+		header string
+		total  int64
+		valid  bool
+	}{
+		{"bytes */1000", 1000, true},
+		{"bytes */0", 0, true},
+		{"bytes */*", 0, false},
+		{"bytes 0-99/1000", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		total, err := parseUnsatisfiedRange(test.header)
+		if (err == nil) != test.valid || (test.valid && total != test.total) {
+			t.Errorf("parseUnsatisfiedRange(%q) = %d, %v; want %d, valid %v", test.header, total, err, test.total, test.valid)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// groupPattern is an --include or --exclude pattern: a glob such as
+// fg-optional-*, or a regular expression when prefixed with "re:". Both
+// ignore case; globs must match a whole name, expressions any part of it.
+type groupPattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+// compilePatterns parses the patterns of a flag
+func compilePatterns(flagName string, patterns []string) ([]groupPattern, error) {
+	compiled := make([]groupPattern, 0, len(patterns))
+	for _, text := range patterns {
+		var pattern groupPattern
+		if expr, ok := strings.CutPrefix(text, "re:"); ok {
+			regex, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --%s pattern %q: %w", flagName, text, err)
+			}
+			pattern.regex = regex
+		} else {
+			pattern.glob = strings.ToLower(text)
+			if _, err := path.Match(pattern.glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid --%s pattern %q: %w", flagName, text, err)
+			}
+		}
+		compiled = append(compiled, pattern)
+	}
+	return compiled, nil
+}
+
+// matchName reports whether the pattern matches one name
+func (p groupPattern) matchName(name string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, strings.ToLower(name))
+	return matched
+}
+
+// matches reports whether the pattern matches the group's ID, its name or the
+// name of one of its files. Names are tried with and without the game title
+// and site marker in front, so fg-optional-* matches
+// Game_--_fitgirl-repacks.site_--_fg-optional-ost.bin.
+func (p groupPattern) matches(group *FileGroup) bool {
+	names := []string{group.ID, group.Name, group.shortName()}
+	for _, link := range group.Files {
+		filename := extractFilenameFromURL(link)
+		names = append(names, filename)
+		if i := strings.LastIndex(strings.ToLower(filename), siteMarker); i >= 0 {
+			names = append(names, filename[i+len(siteMarker):])
+		}
+	}
+
+	for _, name := range names {
+		if name != "" && p.matchName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPatterns narrows the selection by the --include and --exclude patterns.
+// With include patterns only the selected groups matching one of them stay
+// selected; groups matching an exclude pattern are deselected in any case.
+// Patterns never select a group, so they cannot undo --groups.
+func applyPatterns(groups []FileGroup, include, exclude []string) error {
+	includes, err := compilePatterns("include", include)
+	if err != nil {
+		return err
+	}
+	excludes, err := compilePatterns("exclude", exclude)
+	if err != nil {
+		return err
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		if len(includes) > 0 {
+			group.Selected = group.Selected && matchesAny(includes, group)
+		}
+		if matchesAny(excludes, group) {
+			group.Selected = false
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether any of the patterns matches the group
+func matchesAny(patterns []groupPattern, group *FileGroup) bool {
+	for _, pattern := range patterns {
+		if pattern.matches(group) {
+			return true
+		}
+	}
+	return false
+}
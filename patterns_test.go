@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testReleaseLinks is a FitGirl paste with core, optional, language and installer files
+var testReleaseLinks = []string{
+	"https://fuckingfast.co/a#Game_--_fitgirl-repacks.site_--_fg-01.bin",
+	"https://fuckingfast.co/b#Game_--_fitgirl-repacks.site_--_fg-02.bin",
+	"https://fuckingfast.co/c#Game_--_fitgirl-repacks.site_--_fg-optional-ost.bin",
+	"https://fuckingfast.co/d#Game_--_fitgirl-repacks.site_--_fg-selective-english.bin",
+	"https://fuckingfast.co/e#Game_--_fitgirl-repacks.site_--_fg-selective-french.bin",
+	"https://fuckingfast.co/f#Game_--_fitgirl-repacks.site_--_setup.exe",
+}
+
+// selectedIDs lists the IDs of the selected groups, sorted
+func selectedIDs(groups []FileGroup) []string {
+	ids := []string{}
+	for _, group := range groups {
+		if group.Selected {
+			ids = append(ids, group.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestApplyPatterns(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"exclude glob", nil, []string{"fg-optional-*"},
+			[]string{"fg", "fg-selective-english", "fg-selective-french", "setup"}},
+		{"include one group", []string{"fg-selective-english"}, nil,
+			[]string{"fg-selective-english"}},
+		{"include by file name", []string{"FG-[0-9]*", "setup.exe"}, nil,
+			[]string{"fg", "setup"}},
+		{"include and exclude regex", []string{"re:^fg"}, []string{"re:selective-(french|german)"},
+			[]string{"fg", "fg-optional-ost", "fg-selective-english"}},
+		{"full file name", []string{"Game_--_fitgirl-repacks.site_--_setup.exe"}, nil,
+			[]string{"setup"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups := groupDownloadLinks(testReleaseLinks)
+			if err := applyPatterns(groups, test.include, test.exclude); err != nil {
+				t.Fatal(err)
+			}
+			if got := selectedIDs(groups); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatternsInvalid(t *testing.T) {
+	groups := groupDownloadLinks(testReleaseLinks)
+	if err := applyPatterns(groups, []string{"["}, nil); err == nil {
+		t.Error("invalid glob was accepted")
+	}
+	if err := applyPatterns(groups, nil, []string{"re:("}); err == nil {
+		t.Error("invalid regular expression was accepted")
+	}
+}
+
+func TestIncludeNarrowsGroups(t *testing.T) {
+	config := Config{Groups: "fg,setup", Include: stringList{"fg*", "fg-selective-*"}}
+	groups := selectGroups(config, testReleaseLinks, nil)
+
+	// fg-selective-english matches the include pattern but was not listed
+	if got, want := selectedIDs(groups), []string{"fg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+}
+
+func TestExcludeWithGroups(t *testing.T) {
+	config := Config{Groups: "fg,fg-optional-ost", Exclude: stringList{"fg-optional-*"}}
+	groups := selectGroups(config, testReleaseLinks, nil)
+
+	if got, want := selectedIDs(groups), []string{"fg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+}
+
+func TestIncludeIgnoresLanguageDefault(t *testing.T) {
+	config := Config{Language: "english", Include: stringList{"fg-selective-french"}}
+	groups := selectGroups(config, testReleaseLinks, nil)
+
+	if got, want := selectedIDs(groups), []string{"fg-selective-french"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+}
+
+func TestExcludeKeepsLanguageDefault(t *testing.T) {
+	config := Config{Language: "english", Exclude: stringList{"setup*"}}
+	groups := selectGroups(config, testReleaseLinks, nil)
+
+	want := []string{"fg", "fg-optional-ost", "fg-selective-english"}
+	if got := selectedIDs(groups); !reflect.DeepEqual(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// jobOutcome is the result of processing one download job
+type jobOutcome int
+
+const (
+	outcomeSuccess jobOutcome = iota
+	outcomeFailed
+	outcomeCancelled
+)
+
+// DownloadSummary counts how the jobs of a run ended
+type DownloadSummary struct {
+	Succeeded int
+	Failed    int
+	Cancelled int
+	// FromMirror counts successful files that were served by a mirror
+	FromMirror int
+	// Reasons counts the failed files by the class of their last error
+	Reasons map[ErrorClass]int
+	// Aborted is the error that stopped the whole run, if any
+	Aborted error
+}
+
+// add counts one job result
+func (s *DownloadSummary) add(result jobResult) {
+	switch result.outcome {
+	case outcomeSuccess:
+		s.Succeeded++
+		if result.mirrored {
+			s.FromMirror++
+		}
+	case outcomeFailed:
+		s.Failed++
+		if s.Reasons == nil {
+			s.Reasons = make(map[ErrorClass]int)
+		}
+		s.Reasons[errorClass(result.err)]++
+	case outcomeCancelled:
+		s.Cancelled++
+	}
+}
+
+// reasonsText lists the failure reasons, most frequent first
+func (s *DownloadSummary) reasonsText() string {
+	classes := make([]ErrorClass, 0, len(s.Reasons))
+	for class := range s.Reasons {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if s.Reasons[classes[i]] != s.Reasons[classes[j]] {
+			return s.Reasons[classes[i]] > s.Reasons[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		parts = append(parts, fmt.Sprintf("%s: %d", class, s.Reasons[class]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// downloadTask is one file of a job waiting for a worker
+type downloadTask struct {
+	link string
+	job  *Job
+	// size is the file size estimated before the run; -1 when unknown, and 0
+	// when the task is not part of the progress total yet
+	size int64
+}
+
+// partial returns the sidecar of the task's interrupted download, or nil
+func (t *downloadTask) partial() *partialState {
+	path := filepath.Join(t.job.config.DownloadDir, extractFilenameFromURL(t.link))
+	state, err := loadPartialState(path + sidecarSuffix)
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// jobResult is what a worker reports for one task
+type jobResult struct {
+	job      *Job
+	outcome  jobOutcome
+	servedBy string
+	mirrored bool
+	// err is the last error of a failed task
+	err error
+}
+
+// runWorkerPool downloads the tasks with config.WorkerCount concurrent workers,
+// retrying failed downloads. Tasks of different jobs share the same workers.
+// Once the context is cancelled no new downloads are started and the remaining
+// tasks are counted as cancelled. A full disk aborts the whole run the same
+// way, while free space below --min-free only holds back new downloads. With
+// --adaptive the number of busy workers follows the hoster's behaviour between
+// --min-workers and --max-workers. The status of every file is recorded in the
+// state of its job, and each job's summary is filled in.
+func runWorkerPool(ctx context.Context, tasks []downloadTask, logger *ConsoleLogger, config Config) DownloadSummary {
+	// Cancelling with a cause lets the summary tell an abort from Ctrl+C
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	// Create a channel for the tasks
+	jobs := make(chan downloadTask, len(tasks))
+	results := make(chan jobResult, len(tasks))
+	var wg sync.WaitGroup
+
+	// In adaptive mode every possible worker is started, but only those within
+	// the current limit take tasks
+	var controller *concurrencyController
+	workerCount := config.WorkerCount
+	if config.Adaptive {
+		controller = newConcurrencyController(config)
+		workerCount = config.MaxWorkers
+		adaptCtx, stopAdapting := context.WithCancel(ctx)
+		defer stopAdapting()
+		go controller.run(adaptCtx, logger)
+	}
+
+	monitor := newSpaceMonitor(config)
+
+	// Launch worker pool
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			for {
+				controller.wait(ctx, workerID)
+				task, ok := <-jobs
+				if !ok {
+					controller.finish()
+					return
+				}
+				monitor.wait(ctx, logger)
+				if ctx.Err() != nil {
+					results <- jobResult{job: task.job, outcome: outcomeCancelled}
+					continue
+				}
+
+				url, state := task.link, task.job.state
+				setStatus(state, logger, url, StatusInProgress, "")
+				logger.StartTask(workerID, task.size)
+				result := downloadFromSources(ctx, state.Sources(url), task.job.downloader, logger, controller, config, workerID)
+				logger.FinishTask(workerID, result.outcome == outcomeSuccess)
+				result.job = task.job
+				switch result.outcome {
+				case outcomeSuccess:
+					if result.mirrored {
+						if err := state.SetServedBy(url, result.servedBy); err != nil {
+							logger.Log("Could not update job state: %v", err)
+						}
+					}
+					setStatus(state, logger, url, StatusDone, "")
+					task.job.fileDone(url)
+				case outcomeFailed:
+					setStatus(state, logger, url, StatusFailed,
+						fmt.Sprintf("%s: %v", errorClass(result.err), result.err))
+					if errorClass(result.err) == ClassDiskFull {
+						logger.Log("[Worker %d] Disk full; aborting all downloads", workerID)
+						abort(result.err)
+					}
+				case outcomeCancelled:
+					setStatus(state, logger, url, StatusPending, "")
+				}
+
+				results <- result
+				if result.outcome != outcomeCancelled {
+					logger.UpdateProgress(1)
+				}
+			}
+		}(i + 1)
+	}
+
+	// Feed job channel with tasks
+	for _, task := range tasks {
+		jobs <- task
+	}
+	close(jobs)
+
+	// Wait for workers to finish
+	wg.Wait()
+	close(results)
+
+	// Collect results
+	var summary DownloadSummary
+	for result := range results {
+		summary.add(result)
+		result.job.summary.add(result)
+	}
+	if cause := context.Cause(ctx); cause != nil && cause != context.Canceled {
+		summary.Aborted = cause
+	}
+
+	return summary
+}
+
+// downloadFromSources tries the primary link and then each mirror in turn,
+// moving on to the next source once the retries on the current one are used up
+func downloadFromSources(ctx context.Context, sources []string, downloader *Downloader, logger *ConsoleLogger, controller *concurrencyController, config Config, workerID int) jobResult {
+	var lastErr error
+	for i, source := range sources {
+		if _, err := hosterFor(source); err != nil {
+			continue
+		}
+		if i > 0 {
+			logger.Log("[Worker %d] Falling back to mirror %d/%d: %s", workerID, i, len(sources)-1, source)
+		}
+
+		outcome, err := downloadWithRetry(ctx, source, downloader, logger, controller, config, workerID)
+		if outcome != outcomeFailed {
+			return jobResult{outcome: outcome, servedBy: source, mirrored: i > 0}
+		}
+		lastErr = err
+		// No mirror can write to a full disk
+		if errorClass(err) == ClassDiskFull {
+			break
+		}
+	}
+
+	return jobResult{outcome: outcomeFailed, err: lastErr}
+}
+
+// downloadWithRetry downloads one link, retrying up to config.RetryAttempts
+// times with a delay that depends on why the last attempt failed
+func downloadWithRetry(ctx context.Context, url string, downloader *Downloader, logger *ConsoleLogger, controller *concurrencyController, config Config, workerID int) (jobOutcome, error) {
+	var err error
+	for attempt := 1; attempt <= config.RetryAttempts; attempt++ {
+		if attempt > 1 {
+			logger.Log("[Worker %d] Retry attempt %d/%d for %s",
+				workerID, attempt, config.RetryAttempts, url)
+		}
+
+		if err = downloader.Download(ctx, url, workerID); err == nil {
+			return outcomeSuccess, nil
+		}
+		if ctx.Err() != nil {
+			return outcomeCancelled, ctx.Err()
+		}
+		controller.reportError(err)
+
+		delay, retry := retryDelay(err, attempt)
+		if !retry {
+			logger.Log("[Worker %d] Not retrying %s: %s", workerID, url, errorClass(err))
+			break
+		}
+
+		// Wait before retrying
+		if attempt < config.RetryAttempts {
+			if errorClass(err) == ClassRateLimited {
+				logger.Log("[Worker %d] Rate limited; backing off for %s", workerID, formatDuration(delay))
+			}
+			if !sleepContext(ctx, delay) {
+				return outcomeCancelled, ctx.Err()
+			}
+		}
+	}
+
+	return outcomeFailed, err
+}
+
+// setStatus records a file status, reporting a failure to write the state file
+func setStatus(state *JobState, logger *ConsoleLogger, url string, status FileStatus, errMsg string) {
+	if err := state.SetStatus(url, status, errMsg); err != nil {
+		logger.Log("Could not update job state: %v", err)
+	}
+}
+
+// forEachConcurrently calls fn for the indexes 0 to n-1, at most workers calls
+// at a time, and stops handing out indexes once the context is cancelled. It
+// runs the probes that precede the downloads alongside each other.
+func forEachConcurrently(ctx context.Context, workers, n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+}
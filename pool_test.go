@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mirrorHoster is a second fake hoster, for links on https://mirror.test/
+type mirrorHoster struct {
+	fakeHoster
+}
+
+func (h *mirrorHoster) Name() string { return "mirror" }
+func (h *mirrorHoster) Match(link string) bool {
+	return strings.HasPrefix(link, "https://mirror.test/")
+}
+
+func TestDownloadFromSourcesFallsBackToMirrorHoster(t *testing.T) {
+	server, _ := resumeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		serveRanges(w, r)
+	})
+	useHoster(t,
+		&fakeHoster{resolved: ResolvedLink{URL: server.URL + "/gone", Size: -1}},
+		&mirrorHoster{fakeHoster{resolved: ResolvedLink{URL: server.URL + "/file", Size: -1}}},
+	)
+
+	// The primary paste is on one hoster, a second mirror paste on another
+	links, added := mergeMirrorLinks(
+		[]string{"https://fake.test/a#Game.part1.rar"},
+		[]string{"https://mirror.test/x#Game.part1.rar", "https://mirror.test/y#Bonus.rar"},
+	)
+	if added != 1 {
+		t.Fatalf("merged %d mirror links, want 1", added)
+	}
+	groups := groupDownloadLinks(links)
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1: %v", len(groups), groupNames(groups))
+	}
+
+	config := Config{DownloadDir: t.TempDir(), RetryAttempts: 2}
+	logger := NewConsoleLogger(1, 1, "test")
+	d := NewDownloader(config, server.Client(), nil, logger, nil, nil)
+	sources := groups[0].Sources(groups[0].Files[0])
+	result := downloadFromSources(context.Background(), sources, d, logger, newConcurrencyController(config), config, 1)
+
+	if result.outcome != outcomeSuccess || !result.mirrored || result.servedBy != "https://mirror.test/x#Game.part1.rar" {
+		t.Fatalf("result = %+v, want success from the mirror", result)
+	}
+	data, err := os.ReadFile(filepath.Join(config.DownloadDir, "Game.part1.rar"))
+	if err != nil || string(data) != resumeContent {
+		t.Errorf("mirror download saved %d bytes, err %v", len(data), err)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// base58Alphabet is the Bitcoin alphabet used by PrivateBin for paste keys
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// pasteKeySize is the length of the symmetric key carried in the URL fragment
+const pasteKeySize = 32
+
+// pasteResponse is the JSON document returned by a PrivateBin instance for a paste
+type pasteResponse struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Version int             `json:"v"`
+	AData   json.RawMessage `json:"adata"`
+	CT      string          `json:"ct"`
+}
+
+// pasteCipherSpec describes how a paste was encrypted (first element of adata)
+type pasteCipherSpec struct {
+	IV          []byte
+	Salt        []byte
+	Iterations  int
+	KeySize     int
+	TagSize     int
+	Algorithm   string
+	Mode        string
+	Compression string
+}
+
+// pastePlaintext is the decrypted paste content
+type pastePlaintext struct {
+	Paste string `json:"paste"`
+}
+
+var (
+	markdownLinkRegex = regexp.MustCompile(`\[[^\]]*\]\((https?://[^)\s]+)\)`)
+	hrefRegex         = regexp.MustCompile(`href=["'](https?://[^"']+)["']`)
+	bareURLRegex      = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+`)
+)
+
+// fetchPasteLinks downloads a PrivateBin paste, decrypts it with the key from the
+// URL fragment and returns the links listed in it. No browser is involved.
+func fetchPasteLinks(ctx context.Context, pasteURL string, timeout time.Duration) ([]string, error) {
+	requestURL, key, err := splitPasteURL(pasteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	paste, err := fetchPaste(ctx, requestURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := decryptPaste(paste, key)
+	if err != nil {
+		return nil, err
+	}
+
+	links := parsePasteLinks(text)
+	if len(links) == 0 {
+		return nil, fmt.Errorf("no links found in the paste")
+	}
+
+	return links, nil
+}
+
+// splitPasteURL separates the paste URL from the base58 key in its fragment
+func splitPasteURL(pasteURL string) (string, []byte, error) {
+	u, err := url.Parse(pasteURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid paste URL: %w", err)
+	}
+
+	// Burn-after-reading pastes prefix the key with "-" to ask for confirmation
+	fragment := strings.TrimPrefix(u.Fragment, "-")
+	// Some redirectors append data after the key, separated by "&"
+	if idx := strings.Index(fragment, "&"); idx != -1 {
+		fragment = fragment[:idx]
+	}
+	if fragment == "" {
+		return "", nil, fmt.Errorf("paste URL has no decryption key in its fragment")
+	}
+
+	key, err := base58Decode(fragment)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid paste key: %w", err)
+	}
+	if len(key) > pasteKeySize {
+		return "", nil, fmt.Errorf("invalid paste key: %d bytes, expected %d", len(key), pasteKeySize)
+	}
+
+	// PrivateBin left-pads the decoded key with zero bytes
+	padded := make([]byte, pasteKeySize)
+	copy(padded[pasteKeySize-len(key):], key)
+
+	u.Fragment = ""
+	return u.String(), padded, nil
+}
+
+// fetchPaste requests the JSON representation of a paste
+func fetchPaste(ctx context.Context, requestURL string, timeout time.Duration) (*pasteResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	// PrivateBin answers with JSON instead of the HTML page when this header is set
+	req.Header.Set("X-Requested-With", "JSONHttpRequest")
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch paste: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch paste: %s", resp.Status)
+	}
+
+	var paste pasteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&paste); err != nil {
+		return nil, fmt.Errorf("could not decode paste response: %w", err)
+	}
+	if paste.Status != 0 {
+		return nil, fmt.Errorf("paste server error: %s", paste.Message)
+	}
+	if paste.Version != 2 {
+		return nil, fmt.Errorf("unsupported paste format version %d", paste.Version)
+	}
+
+	return &paste, nil
+}
+
+// decryptPaste decrypts and decompresses a version 2 paste and returns its text
+func decryptPaste(paste *pasteResponse, key []byte) (string, error) {
+	var adata []json.RawMessage
+	if err := json.Unmarshal(paste.AData, &adata); err != nil || len(adata) == 0 {
+		return "", fmt.Errorf("invalid paste metadata")
+	}
+
+	spec, err := parseCipherSpec(adata[0])
+	if err != nil {
+		return "", err
+	}
+	if spec.Algorithm != "aes" || spec.Mode != "gcm" {
+		return "", fmt.Errorf("unsupported paste cipher %s-%s", spec.Algorithm, spec.Mode)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(paste.CT)
+	if err != nil {
+		return "", fmt.Errorf("invalid paste ciphertext: %w", err)
+	}
+
+	derived := pbkdf2SHA256(key, spec.Salt, spec.Iterations, spec.KeySize/8)
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return "", fmt.Errorf("could not create cipher: %w", err)
+	}
+	gcm, err := newPasteGCM(block, len(spec.IV), spec.TagSize/8)
+	if err != nil {
+		return "", err
+	}
+
+	additional, err := pasteAdditionalData(paste.AData)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := gcm.Open(nil, spec.IV, ciphertext, additional)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt paste (wrong key?): %w", err)
+	}
+
+	switch spec.Compression {
+	case "zlib":
+		// PrivateBin uses raw deflate despite the name
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			return "", fmt.Errorf("could not decompress paste: %w", err)
+		}
+	case "none", "":
+	default:
+		return "", fmt.Errorf("unsupported paste compression %q", spec.Compression)
+	}
+
+	var content pastePlaintext
+	if err := json.Unmarshal(plain, &content); err != nil {
+		return "", fmt.Errorf("could not decode paste content: %w", err)
+	}
+
+	return content.Paste, nil
+}
+
+// pasteAdditionalData serializes adata the way the PrivateBin client does with
+// JSON.stringify, which is what it authenticated. The server's bytes cannot be
+// used as they are: it may escape slashes in the base64 IV and salt.
+func pasteAdditionalData(raw json.RawMessage) ([]byte, error) {
+	var adata []interface{}
+	if err := json.Unmarshal(raw, &adata); err != nil {
+		return nil, fmt.Errorf("invalid paste metadata: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(adata); err != nil {
+		return nil, fmt.Errorf("invalid paste metadata: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// parseCipherSpec decodes [iv, salt, iterations, keysize, tagsize, algo, mode, compression]
+func parseCipherSpec(raw json.RawMessage) (*pasteCipherSpec, error) {
+	var fields []interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil || len(fields) < 8 {
+		return nil, fmt.Errorf("invalid paste cipher parameters")
+	}
+
+	spec := &pasteCipherSpec{}
+	var ok bool
+	var iv, salt string
+	var iterations, keySize, tagSize float64
+
+	if iv, ok = fields[0].(string); !ok {
+		return nil, fmt.Errorf("invalid paste IV")
+	}
+	if salt, ok = fields[1].(string); !ok {
+		return nil, fmt.Errorf("invalid paste salt")
+	}
+	if iterations, ok = fields[2].(float64); !ok {
+		return nil, fmt.Errorf("invalid paste iteration count")
+	}
+	if keySize, ok = fields[3].(float64); !ok {
+		return nil, fmt.Errorf("invalid paste key size")
+	}
+	if tagSize, ok = fields[4].(float64); !ok {
+		return nil, fmt.Errorf("invalid paste tag size")
+	}
+	spec.Algorithm, _ = fields[5].(string)
+	spec.Mode, _ = fields[6].(string)
+	spec.Compression, _ = fields[7].(string)
+
+	var err error
+	if spec.IV, err = base64.StdEncoding.DecodeString(iv); err != nil {
+		return nil, fmt.Errorf("invalid paste IV: %w", err)
+	}
+	if spec.Salt, err = base64.StdEncoding.DecodeString(salt); err != nil {
+		return nil, fmt.Errorf("invalid paste salt: %w", err)
+	}
+	spec.Iterations = int(iterations)
+	spec.KeySize = int(keySize)
+	spec.TagSize = int(tagSize)
+
+	if spec.Iterations < 1 || (spec.KeySize != 128 && spec.KeySize != 192 && spec.KeySize != 256) {
+		return nil, fmt.Errorf("unsupported paste key parameters")
+	}
+
+	return spec, nil
+}
+
+// newPasteGCM builds an AES-GCM AEAD for the nonce and tag sizes used by the paste
+func newPasteGCM(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	switch {
+	case nonceSize == 12 && tagSize == 16:
+		return cipher.NewGCM(block)
+	case tagSize == 16:
+		return cipher.NewGCMWithNonceSize(block, nonceSize)
+	case nonceSize == 12:
+		return cipher.NewGCMWithTagSize(block, tagSize)
+	default:
+		return nil, fmt.Errorf("unsupported paste nonce/tag sizes %d/%d", nonceSize, tagSize)
+	}
+}
+
+// pbkdf2SHA256 derives a key using PBKDF2 with HMAC-SHA256 (RFC 8018)
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	derived := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, hashLen)
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+
+	return derived[:keyLen]
+}
+
+// base58Decode decodes a Bitcoin-alphabet base58 string
+func base58Decode(s string) ([]byte, error) {
+	result := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		result.Mul(result, radix)
+		result.Add(result, big.NewInt(int64(idx)))
+	}
+
+	decoded := result.Bytes()
+
+	// Each leading '1' encodes a leading zero byte
+	leadingZeros := 0
+	for leadingZeros < len(s) && s[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
+
+	return append(make([]byte, leadingZeros), decoded...), nil
+}
+
+// parsePasteLinks extracts the download links from the paste text. FitGirl pastes
+// are markdown lists, but HTML anchors and bare URLs are accepted as well.
+func parsePasteLinks(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, m := range markdownLinkRegex.FindAllStringSubmatch(text, -1) {
+		add(m[1])
+	}
+	for _, m := range hrefRegex.FindAllStringSubmatch(text, -1) {
+		add(m[1])
+	}
+
+	// Fall back to bare URLs when the paste is plain text
+	if len(links) == 0 {
+		for _, m := range bareURLRegex.FindAllString(text, -1) {
+			add(strings.TrimRight(m, ".,;:"))
+		}
+	}
+
+	return links
+}
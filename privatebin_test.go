@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// base58Encode is the inverse of base58Decode
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func TestBase58Decode(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    []byte
+	}{
+		{"", []byte{}},
+		{"1", []byte{0}},
+		{"11", []byte{0, 0}},
+		{"2", []byte{1}},
+		{"z", []byte{57}},
+		{"21", []byte{58}},
+		{"5Q", []byte{0xff}},
+		{"StV1DL6CwTryKyV", []byte("hello world")},
+	}
+	for _, test := range tests {
+		got, err := base58Decode(test.encoded)
+		if err != nil {
+			t.Fatalf("base58Decode(%q): %v", test.encoded, err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("base58Decode(%q) = %x, want %x", test.encoded, got, test.want)
+		}
+	}
+
+	if _, err := base58Decode("0OIl"); err == nil {
+		t.Error("base58Decode accepted characters outside the alphabet")
+	}
+}
+
+func TestBase58RoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		{0, 0, 1, 2, 3},
+		bytes.Repeat([]byte{0xff}, pasteKeySize),
+		[]byte("0123456789abcdef0123456789abcdef"),
+	}
+	for _, input := range inputs {
+		got, err := base58Decode(base58Encode(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, input) {
+			t.Errorf("round trip of %x gave %x", input, got)
+		}
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vectors for PBKDF2-HMAC-SHA256 from RFC 7914 and common references
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, test.keyLen))
+		if got != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
+
+// encryptPaste encrypts text the way the PrivateBin client does. With
+// escapeSlashes the adata is returned the way some servers serialize it.
+func encryptPaste(t *testing.T, text string, key, iv, salt []byte, escapeSlashes bool) *pasteResponse {
+	t.Helper()
+
+	spec := []interface{}{
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(salt),
+		100000, 256, 128, "aes", "gcm", "zlib",
+	}
+	adata := []interface{}{spec, "plaintext", 0, 0}
+	// JSON.stringify escapes neither slashes nor HTML characters
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(adata); err != nil {
+		t.Fatal(err)
+	}
+	authenticated := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	content, err := json.Marshal(pastePlaintext{Paste: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(content)
+	writer.Close()
+
+	block, err := aes.NewCipher(pbkdf2SHA256(key, salt, 100000, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := gcm.Seal(nil, iv, compressed.Bytes(), authenticated)
+
+	served := string(authenticated)
+	if escapeSlashes {
+		served = strings.ReplaceAll(served, "/", `\/`)
+	}
+	return &pasteResponse{
+		Version: 2,
+		AData:   json.RawMessage(served),
+		CT:      base64.StdEncoding.EncodeToString(ciphertext),
+	}
+}
+
+func TestDecryptPasteRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	text := "- [Game.part01.rar](https://fuckingfast.co/abc#Game.part01.rar)"
+
+	tests := []struct {
+		name          string
+		iv, salt      []byte
+		escapeSlashes bool
+	}{
+		{"plain", []byte("iv-12-bytes!"), []byte("saltsalt"), false},
+		// 0xff bytes encode as "/" in base64
+		{"slash in IV", bytes.Repeat([]byte{0xff}, 12), []byte("saltsalt"), false},
+		{"escaped slashes", bytes.Repeat([]byte{0xff}, 12), []byte{0xfb, 0xff, 0xbf, 1, 2, 3, 4, 5}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paste := encryptPaste(t, text, key, test.iv, test.salt, test.escapeSlashes)
+			if test.escapeSlashes && !strings.Contains(string(paste.AData), `\/`) {
+				t.Fatalf("adata %s has no escaped slash", paste.AData)
+			}
+
+			got, err := decryptPaste(paste, key)
+			if err != nil {
+				t.Fatalf("decryptPaste: %v", err)
+			}
+			if got != text {
+				t.Errorf("decryptPaste = %q, want %q", got, text)
+			}
+		})
+	}
+}
+
+func TestDecryptPasteWrongKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	paste := encryptPaste(t, "secret", key, []byte("iv-12-bytes!"), []byte("saltsalt"), false)
+
+	wrong := bytes.Repeat([]byte{1}, pasteKeySize)
+	if _, err := decryptPaste(paste, wrong); err == nil {
+		t.Error("decryptPaste succeeded with the wrong key")
+	}
+}
+
+func TestSplitPasteURL(t *testing.T) {
+	key := append([]byte{0, 0}, bytes.Repeat([]byte{7}, pasteKeySize-2)...)
+	encoded := base58Encode(key)
+
+	requestURL, got, err := splitPasteURL("https://paste.fitgirl-repacks.site/?abc#-" + encoded + "&extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestURL != "https://paste.fitgirl-repacks.site/?abc" {
+		t.Errorf("request URL = %q", requestURL)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("key = %x, want %x", got, key)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateBurst is the largest number of bytes the limiter lets through at once
+// after an idle period
+const rateBurst = 256 << 10
+
+// rateWindow is one entry of a --schedule: a time of day range with its own limit
+type rateWindow struct {
+	start, end time.Duration // offsets from midnight; end may be before start
+	rate       int64         // bytes per second, 0 for unlimited
+}
+
+// contains reports whether the time of day falls into the window
+func (w rateWindow) contains(offset time.Duration) bool {
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	// The window wraps around midnight
+	return offset >= w.start || offset < w.end
+}
+
+// RateLimiter is a token bucket shared by all transfers of a run. The rate
+// follows the schedule, so it changes live during a long run.
+type RateLimiter struct {
+	mutex    sync.Mutex
+	base     int64
+	schedule []rateWindow
+	rate     int64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter creates a limiter from the --limit-rate and --schedule values.
+// Returns nil when neither limits anything.
+func NewRateLimiter(limit, schedule string) (*RateLimiter, error) {
+	base, err := parseRate(limit)
+	if err != nil {
+		return nil, err
+	}
+	windows, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if base == 0 && len(windows) == 0 {
+		return nil, nil
+	}
+
+	rl := &RateLimiter{base: base, schedule: windows, last: time.Now()}
+	rl.rate = rl.scheduledRate(rl.last)
+	return rl, nil
+}
+
+// scheduledRate returns the limit that applies at the given time
+func (rl *RateLimiter) scheduledRate(now time.Time) int64 {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	for _, window := range rl.schedule {
+		if window.contains(offset) {
+			return window.rate
+		}
+	}
+	return rl.base
+}
+
+// refill adds the tokens earned since the last call and applies the schedule;
+// the caller must hold the mutex
+func (rl *RateLimiter) refill(now time.Time) {
+	if rate := rl.scheduledRate(now); rate != rl.rate {
+		rl.rate = rate
+		rl.tokens = 0
+	}
+	if rl.rate > 0 {
+		rl.tokens += now.Sub(rl.last).Seconds() * float64(rl.rate)
+		if burst := float64(min(rl.rate, rateBurst)); rl.tokens > burst {
+			rl.tokens = burst
+		}
+	}
+	rl.last = now
+}
+
+// Rate returns the current limit in bytes per second, 0 when unlimited
+func (rl *RateLimiter) Rate() int64 {
+	if rl == nil {
+		return 0
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.refill(time.Now())
+	return rl.rate
+}
+
+// Wait blocks until n more bytes may be transferred. A nil limiter never waits.
+func (rl *RateLimiter) Wait(ctx context.Context, n int) error {
+	if rl == nil {
+		return nil
+	}
+
+	rl.mutex.Lock()
+	rl.refill(time.Now())
+	if rl.rate == 0 {
+		rl.mutex.Unlock()
+		return nil
+	}
+	// Take the bytes now and sleep off the debt, so concurrent callers queue up
+	rl.tokens -= float64(n)
+	delay := time.Duration(-rl.tokens / float64(rl.rate) * float64(time.Second))
+	rl.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if !sleepContext(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Reader wraps a reader so that reading from it respects the limit
+func (rl *RateLimiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	if rl == nil {
+		return reader
+	}
+	return &limitedReader{ctx: ctx, reader: reader, limiter: rl}
+}
+
+// String describes the current limit for the progress header
+func (rl *RateLimiter) String() string {
+	if rate := rl.Rate(); rate > 0 {
+		return formatBytes(rate) + "/s"
+	}
+	return "unlimited"
+}
+
+// limitedReader delays reads to stay within a RateLimiter
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// Small reads keep the throughput smooth at low rates
+	if len(p) > 32<<10 {
+		p = p[:32<<10]
+	}
+	n, err := lr.reader.Read(p)
+	if n > 0 {
+		if waitErr := lr.limiter.Wait(lr.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// parseRate parses a rate like "500K", "2M" or "1.5MB/s" into bytes per
+// second. Units are binary; "", "0" and "unlimited" mean no limit.
+func parseRate(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	if text == "" || text == "0" || text == "UNLIMITED" {
+		return 0, nil
+	}
+
+	rate, err := parseSize(strings.TrimSuffix(text, "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q (use e.g. 500K or 2M)", value)
+	}
+	return rate, nil
+}
+
+// parseSize parses a size like "512K", "2G" or "1.5GB" into bytes; units are binary
+func parseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	text = strings.TrimSuffix(text, "IB")
+	text = strings.TrimSuffix(text, "B")
+	multiplier := 1.0
+	if i := strings.IndexAny(text, "KMGT"); i >= 0 && i == len(text)-1 {
+		multiplier = map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}[text[i]]
+		text = text[:i]
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512M or 2G)", value)
+	}
+	// 0 means no limit, which a tiny positive size must not turn into
+	size := int64(number * multiplier)
+	if number > 0 && size == 0 {
+		return 0, fmt.Errorf("invalid size %q: less than one byte", value)
+	}
+	return size, nil
+}
+
+// parseSchedule parses comma-separated windows like "01:00-07:00=0,12:00-13:00=1M"
+func parseSchedule(value string) ([]rateWindow, error) {
+	var windows []rateWindow
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		span, rate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry %q (use HH:MM-HH:MM=RATE)", entry)
+		}
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry %q (use HH:MM-HH:MM=RATE)", entry)
+		}
+
+		var window rateWindow
+		var err error
+		if window.start, err = parseTimeOfDay(from); err != nil {
+			return nil, err
+		}
+		if window.end, err = parseTimeOfDay(to); err != nil {
+			return nil, err
+		}
+		if window.rate, err = parseRate(rate); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseTimeOfDay parses HH:MM into an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (use HH:MM)", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
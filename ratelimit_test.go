@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		rate  int64
+		valid bool
+	}{
+		{"", 0, true},
+		{"0", 0, true},
+		{"unlimited", 0, true},
+		{"500K", 500 << 10, true},
+		{"2M/s", 2 << 20, true},
+		{"1.5KiB", 1536, true},
+		{"1B", 1, true},
+		{"0K", 0, true},
+		{"0.5B", 0, false},
+		{"0.0001K", 0, false},
+		{"-1M", 0, false},
+		{"fast", 0, false},
+	}
+	for _, test := range tests {
+		rate, err := parseRate(test.value)
+		if (err == nil) != test.valid || rate != test.rate {
+			t.Errorf("parseRate(%q) = %d, %v; want %d, valid %v", test.value, rate, err, test.rate, test.valid)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		size  int64
+		valid bool
+	}{
+		{"512K", 512 << 10, true},
+		{"1.5GB", 3 << 29, true},
+		{"2gib", 2 << 30, true},
+		{"100", 100, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"B", 0, false},
+		{"K", 0, false},
+		{"0.5", 0, false},
+		{"1X", 0, false},
+	}
+	for _, test := range tests {
+		size, err := parseSize(test.value)
+		if (err == nil) != test.valid || size != test.size {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, valid %v", test.value, size, err, test.size, test.valid)
+		}
+	}
+}
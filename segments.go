@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// minSegmentSize keeps small files from being split into tiny ranges
+const minSegmentSize = 4 << 20
+
+// errRangesUnsupported means the server cannot serve byte ranges, so the file
+// has to be fetched over a single connection
+var errRangesUnsupported = errors.New("server does not support byte ranges")
+
+// errSourceChanged means the server no longer has the file the segments were
+// started from, so the partial file is useless
+var errSourceChanged = errors.New("file changed on the server")
+
+// segmentError is a segment that stopped early. It ends the attempt, and the
+// next attempt of the worker pool resumes every unfinished segment, so that
+// segments share the retries of their file.
+type segmentError struct {
+	index int
+	err   error
+}
+
+func (e *segmentError) Error() string {
+	return fmt.Sprintf("segment %d: %v", e.index+1, e.err)
+}
+
+func (e *segmentError) Unwrap() error {
+	return e.err
+}
+
+// segment is one byte range of a file fetched over its own connection
+type segment struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"` // inclusive
+	Written int64 `json:"written"`
+}
+
+// next returns the offset of the first byte still missing
+func (s *segment) next() int64 {
+	return s.Start + s.Written
+}
+
+// done reports whether the whole range has been written
+func (s *segment) done() bool {
+	return s.next() > s.End
+}
+
+// splitSegments divides the bytes from offset to total into up to count
+// ranges. Bytes before offset, left by an earlier single-connection attempt,
+// are recorded as one finished segment.
+func splitSegments(offset, total int64, count int) []segment {
+	var segments []segment
+	if offset > 0 {
+		segments = append(segments, segment{Start: 0, End: offset - 1, Written: offset})
+	}
+
+	remaining := total - offset
+	if max := int(remaining / minSegmentSize); count > max {
+		count = max
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	size := remaining / int64(count)
+	start := offset
+	for i := 0; i < count; i++ {
+		end := start + size - 1
+		if i == count-1 {
+			end = total - 1
+		}
+		segments = append(segments, segment{Start: start, End: end})
+		start = end + 1
+	}
+	return segments
+}
+
+// segmentedTransfer shares the partial file and its sidecar between the
+// connections of one download
+type segmentedTransfer struct {
+	d           *Downloader
+	directURL   string
+	link        string
+	workerID    int
+	file        *os.File
+	state       *partialState
+	sidecarPath string
+
+	mutex     sync.Mutex
+	sinceSave int64
+}
+
+// downloadSegmented fetches the file over config.Segments connections into a
+// preallocated .part file. It continues the segments recorded in the sidecar,
+// or splits the file anew after probing for range support. Returns
+// errRangesUnsupported if the file cannot be split, after removing a partial
+// file that only segments could continue.
+func (d *Downloader) downloadSegmented(ctx context.Context, directURL, link, filename string, state *partialState, offset int64, partPath, sidecarPath string, workerID int) error {
+	if len(state.Segments) == 0 {
+		resp, err := d.requestRange(ctx, directURL, link, 0, 0, "")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent {
+			return errRangesUnsupported
+		}
+		_, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || total <= 0 {
+			return errRangesUnsupported
+		}
+
+		// An earlier single-connection attempt only counts for the same file
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if offset > 0 && (state.TotalSize != total || state.ETag != etag || state.LastModified != lastModified) {
+			d.logger.Log("[Worker %d] %s changed on the server; restarting", workerID, filename)
+			offset = 0
+		}
+		if offset > total {
+			offset = 0
+		}
+
+		state.TotalSize = total
+		state.ETag = etag
+		state.LastModified = lastModified
+		state.BytesWritten = offset
+		state.Segments = splitSegments(offset, total, d.config.Segments)
+	}
+
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open partial file: %w", err)
+	}
+	// Reserve the whole file so every connection can write at its offset
+	if err := file.Truncate(state.TotalSize); err != nil {
+		file.Close()
+		return fmt.Errorf("could not preallocate partial file: %w", err)
+	}
+	if err := state.save(sidecarPath); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write sidecar: %w", err)
+	}
+
+	if state.BytesWritten > 0 {
+		d.logger.Log("[Worker %d] Resuming %s at %d bytes", workerID, filename, state.BytesWritten)
+	} else {
+		d.logger.Log("[Worker %d] Starting download of: %s (%d connections)", workerID, filename, len(state.Segments))
+	}
+	d.logger.StartFile(workerID, filename, state.TotalSize, state.BytesWritten)
+
+	transfer := &segmentedTransfer{
+		d:           d,
+		directURL:   directURL,
+		link:        link,
+		workerID:    workerID,
+		file:        file,
+		state:       state,
+		sidecarPath: sidecarPath,
+	}
+	err = transfer.run(ctx)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, errRangesUnsupported) {
+		os.Remove(partPath)
+		os.Remove(sidecarPath)
+		return errRangesUnsupported
+	}
+	if errors.Is(err, errSourceChanged) {
+		os.Remove(partPath)
+		os.Remove(sidecarPath)
+		return fmt.Errorf("%s changed on the server; starting over on the next attempt", filename)
+	}
+
+	// Always record how far every segment got so the next attempt can resume
+	transfer.mutex.Lock()
+	saveErr := state.save(sidecarPath)
+	transfer.mutex.Unlock()
+	if err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return fmt.Errorf("transfer interrupted at %d bytes: %w", state.BytesWritten, err)
+	}
+
+	// Final size check before the file gets its real name
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+	if state.BytesWritten != state.TotalSize || info.Size() != state.TotalSize {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", state.BytesWritten, state.TotalSize)
+	}
+	return nil
+}
+
+// run fetches the unfinished segments in parallel. The first segment that
+// fails stops the others.
+func (t *segmentedTransfer) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(t.state.Segments))
+	for i := range t.state.Segments {
+		if t.state.Segments[i].done() {
+			continue
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			if err := t.fetch(ctx, index); err != nil {
+				errs <- &segmentError{index: index, err: err}
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	// Report the segment that failed first, not the ones it cancelled
+	for err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// fetch requests the missing bytes of a segment and writes them at their offset
+func (t *segmentedTransfer) fetch(ctx context.Context, index int) error {
+	t.mutex.Lock()
+	seg := t.state.Segments[index]
+	validator := t.state.validator()
+	t.mutex.Unlock()
+
+	resp, err := t.d.requestRange(ctx, t.directURL, t.link, seg.next(), seg.End, validator)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		if validator == "" {
+			// Nothing to compare with, so the server simply ignores ranges
+			return errRangesUnsupported
+		}
+		// If-Range did not match, so the server sent the new file instead
+		return errSourceChanged
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return statusError("server", resp)
+	}
+	if start, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != seg.next() {
+		return fmt.Errorf("server returned an unexpected range")
+	}
+
+	position := seg.next()
+	reader := t.d.limiter.Reader(ctx, io.LimitReader(resp.Body, seg.End-position+1))
+	buf := make([]byte, 32<<10)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			if _, err := t.file.WriteAt(buf[:n], position); err != nil {
+				return fmt.Errorf("could not write partial file: %w", err)
+			}
+			position += int64(n)
+			if err := t.record(index, int64(n)); err != nil {
+				return err
+			}
+			t.d.logger.AddBytes(t.workerID, int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.state.Segments[index].done() {
+		return fmt.Errorf("connection closed early")
+	}
+	return nil
+}
+
+// record adds written bytes to a segment and checkpoints the sidecar
+func (t *segmentedTransfer) record(index int, n int64) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state.Segments[index].Written += n
+	t.state.BytesWritten += n
+	t.sinceSave += n
+	if t.sinceSave >= checkpointInterval {
+		t.sinceSave = 0
+		if err := t.state.save(t.sidecarPath); err != nil {
+			return fmt.Errorf("could not update sidecar: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		name          string
+		offset, total int64
+		count         int
+		want          []segment
+	}{
+		{"small file stays whole", 0, 1000, 4, []segment{{Start: 0, End: 999}}},
+		{"two minimum sizes", 0, 2 * minSegmentSize, 4, []segment{
+			{Start: 0, End: minSegmentSize - 1},
+			{Start: minSegmentSize, End: 2*minSegmentSize - 1},
+		}},
+		{"earlier bytes are one finished segment", 100, 1000, 2, []segment{
+			{Start: 0, End: 99, Written: 100},
+			{Start: 100, End: 999},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitSegments(test.offset, test.total, test.count)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSegmentedFallsBackWhenRangeIgnored(t *testing.T) {
+	// The server sends the whole file whatever the Range header says
+	server, _ := resumeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resumeContent))
+	})
+	dir := t.TempDir()
+	link := "https://fake.test/abc#Game.part01.rar"
+	path := filepath.Join(dir, "Game.part01.rar")
+
+	// An earlier segmented attempt stopped without recording a validator
+	part := []byte(resumeContent[:300] + strings.Repeat("\x00", len(resumeContent)-300))
+	if err := os.WriteFile(path+partialSuffix, part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := &partialState{SourceURL: link, TotalSize: int64(len(resumeContent)), BytesWritten: 300,
+		Segments: []segment{{Start: 0, End: 499, Written: 300}, {Start: 500, End: 999}}}
+	if err := state.save(path + sidecarSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{DownloadDir: dir, Segments: 2}
+	d := NewDownloader(config, server.Client(), nil, NewConsoleLogger(1, 1, "test"), nil, nil)
+	hoster := &fakeHoster{resolved: ResolvedLink{URL: server.URL, Size: -1}}
+	if err := d.downloadDirect(context.Background(), hoster, link, 1); err != nil {
+		t.Fatalf("downloadDirect: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != resumeContent {
+		t.Errorf("saved %d bytes, err %v", len(data), err)
+	}
+	if _, err := os.Stat(path + sidecarSuffix); err == nil {
+		t.Error("sidecar was left behind")
+	}
+}
+
+func TestSegmentFailureEndsAttempt(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 2*minSegmentSize/16)
+	secondRange := fmt.Sprintf("bytes=%d-", minSegmentSize)
+
+	// The second segment fails once; everything else is served normally
+	var mutex sync.Mutex
+	failed := false
+	server, ranges := resumeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		fail := !failed && strings.HasPrefix(r.Header.Get("Range"), secondRange)
+		failed = failed || fail
+		mutex.Unlock()
+		if fail {
+			http.Error(w, "backend unavailable", http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	})
+	useHoster(t, &fakeHoster{resolved: ResolvedLink{URL: server.URL, Size: -1}})
+
+	config := Config{DownloadDir: t.TempDir(), Segments: 2, RetryAttempts: 3}
+	d := NewDownloader(config, server.Client(), nil, NewConsoleLogger(1, 1, "test"), nil, nil)
+	link := "https://fake.test/abc#Game.part01.rar"
+
+	// The failed segment ends the attempt without retrying on its own and
+	// without falling back to the browser
+	err := d.Download(context.Background(), link, 1)
+	var segErr *segmentError
+	if !errors.As(err, &segErr) || segErr.index != 1 {
+		t.Fatalf("first attempt returned %v, want a failure of segment 2", err)
+	}
+	countSecond := func() int {
+		var n int
+		for _, r := range *ranges {
+			if strings.HasPrefix(r, secondRange) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := countSecond(); n != 1 {
+		t.Errorf("segment 2 was requested %d times in one attempt, want 1", n)
+	}
+
+	// The next attempt resumes the segments
+	if err := d.Download(context.Background(), link, 1); err != nil {
+		t.Fatalf("second attempt: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(config.DownloadDir, "Game.part01.rar"))
+	if err != nil || string(data) != content {
+		t.Errorf("saved %d of %d bytes, err %v", len(data), len(content), err)
+	}
+	if n := countSecond(); n != 2 {
+		t.Errorf("segment 2 was requested %d times in two attempts, want 2", n)
+	}
+}
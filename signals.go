@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// withInterruptHandling returns a context that is cancelled on the first
+// SIGINT/SIGTERM so that work can stop cleanly. A second signal exits the
+// process immediately.
+func withInterruptHandling(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+
+		log.Println("Interrupt received, stopping downloads (press Ctrl+C again to force exit)...")
+		cancel()
+
+		<-signals
+		log.Println("Forced exit")
+		os.Exit(130)
+	}()
+
+	return ctx, cancel
+}
+
+// sleepContext waits for the duration or until the context is cancelled.
+// Returns false if the context was cancelled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateFileName is the job state file kept in the download directory
+const stateFileName = ".fuckingloader-state.json"
+
+// FileStatus is the download status of a single file in a job
+type FileStatus string
+
+const (
+	StatusPending    FileStatus = "pending"
+	StatusInProgress FileStatus = "in_progress"
+	StatusDone       FileStatus = "done"
+	StatusFailed     FileStatus = "failed"
+)
+
+// FileState records the status of one selected file
+type FileState struct {
+	URL    string     `json:"url"`
+	Name   string     `json:"name"`
+	Status FileStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	// ServedBy is the link that finally delivered the file, if not the primary
+	ServedBy string `json:"served_by,omitempty"`
+	// Size is the size of the file when it was done, which vouches for the
+	// file when a later run cannot ask the hoster
+	Size int64 `json:"size,omitempty"`
+}
+
+// JobState is everything needed to continue an interrupted run without
+// scraping the paste or asking for the selection again
+type JobState struct {
+	SourceURL string       `json:"source_url"`
+	Release   *ReleaseInfo `json:"release,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Groups    []FileGroup  `json:"groups"`
+	Files     []*FileState `json:"files"`
+
+	path    string
+	mutex   sync.Mutex
+	index   map[string]*FileState
+	groupOf map[string]*FileGroup
+}
+
+// NewJobState creates the state for a fresh run; every file of a selected
+// group starts out pending
+func NewJobState(dir, sourceURL string, groups []FileGroup) *JobState {
+	state := &JobState{
+		SourceURL: sourceURL,
+		CreatedAt: time.Now(),
+		Groups:    groups,
+		path:      filepath.Join(dir, stateFileName),
+	}
+
+	for _, group := range groups {
+		if !group.Selected {
+			continue
+		}
+		for _, link := range group.Files {
+			state.Files = append(state.Files, &FileState{
+				URL:    link,
+				Name:   extractFilenameFromURL(link),
+				Status: StatusPending,
+			})
+		}
+	}
+
+	state.buildIndex()
+	return state
+}
+
+// LoadJobState reads the state file from a download directory
+func LoadJobState(dir string) (*JobState, error) {
+	path := filepath.Join(dir, stateFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no saved job found in %s", dir)
+		}
+		return nil, err
+	}
+
+	state := &JobState{path: path}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("corrupt state file %s: %w", path, err)
+	}
+
+	state.buildIndex()
+	return state, nil
+}
+
+func (js *JobState) buildIndex() {
+	js.index = make(map[string]*FileState, len(js.Files))
+	for _, file := range js.Files {
+		js.index[file.URL] = file
+	}
+
+	js.groupOf = make(map[string]*FileGroup)
+	for i := range js.Groups {
+		for _, link := range js.Groups[i].Files {
+			js.groupOf[link] = &js.Groups[i]
+		}
+	}
+}
+
+// Sources returns the link of a file followed by its mirrors
+func (js *JobState) Sources(url string) []string {
+	if group, ok := js.groupOf[url]; ok {
+		return group.Sources(url)
+	}
+	return []string{url}
+}
+
+// CompletedGroup returns the group of a file once every part of it is done,
+// unless it has been extracted already
+func (js *JobState) CompletedGroup(url string) *FileGroup {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	group, ok := js.groupOf[url]
+	if !ok || group.Extracted {
+		return nil
+	}
+	for _, link := range group.Files {
+		if file, ok := js.index[link]; !ok || file.Status != StatusDone {
+			return nil
+		}
+	}
+	return group
+}
+
+// Extracted reports whether the group of a file has been unpacked
+func (js *JobState) Extracted(url string) bool {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	group, ok := js.groupOf[url]
+	return ok && group.Extracted
+}
+
+// SetExtracted records that a group has been unpacked
+func (js *JobState) SetExtracted(group *FileGroup) error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	group.Extracted = true
+	return js.save()
+}
+
+// SetServedBy records which link delivered a file
+func (js *JobState) SetServedBy(url, source string) error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	file, ok := js.index[url]
+	if !ok {
+		return fmt.Errorf("unknown file %s", url)
+	}
+	file.ServedBy = source
+
+	return js.save()
+}
+
+// Links returns the URLs of all selected files in job order
+func (js *JobState) Links() []string {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	links := make([]string, 0, len(js.Files))
+	for _, file := range js.Files {
+		links = append(links, file.URL)
+	}
+	return links
+}
+
+// Status returns the recorded status of a file
+func (js *JobState) Status(url string) FileStatus {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	if file, ok := js.index[url]; ok {
+		return file.Status
+	}
+	return StatusPending
+}
+
+// SetStatus updates the status of a file and writes the state to disk
+func (js *JobState) SetStatus(url string, status FileStatus, errMsg string) error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	file, ok := js.index[url]
+	if !ok {
+		return fmt.Errorf("unknown file %s", url)
+	}
+	file.Status = status
+	file.Error = errMsg
+	file.Size = 0
+	if status == StatusDone {
+		if info, err := os.Stat(filepath.Join(filepath.Dir(js.path), file.Name)); err == nil {
+			file.Size = info.Size()
+		}
+	}
+
+	return js.save()
+}
+
+// RecordedSize returns the size a file had when it was done; 0 if unknown
+func (js *JobState) RecordedSize(url string) int64 {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	if file, ok := js.index[url]; ok {
+		return file.Size
+	}
+	return 0
+}
+
+// inheritSizes takes over the recorded sizes of the files that an earlier job
+// in the same directory finished, so that a new run of the same paste can
+// still vouch for them
+func (js *JobState) inheritSizes(previous *JobState) {
+	sizes := make(map[string]int64)
+	for _, file := range previous.Files {
+		if file.Status == StatusDone && file.Size > 0 {
+			sizes[file.Name] = file.Size
+		}
+	}
+	for _, file := range js.Files {
+		file.Size = sizes[file.Name]
+	}
+}
+
+// Save writes the state to disk
+func (js *JobState) Save() error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	return js.save()
+}
+
+// save writes the state atomically; the caller must hold the mutex
+func (js *JobState) save() error {
+	js.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(js, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := js.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	if err := os.Rename(tmp, js.path); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJobStateSaveAndReload(t *testing.T) {
+	dir := t.TempDir()
+	groups := groupDownloadLinks([]string{
+		"https://fake.test/a#Game.part1.rar",
+		"https://fake.test/b#Game.part2.rar",
+		"https://mirror.test/c#Game.part2.rar",
+		"https://fake.test/d#Game_--_fg-optional-ost.bin",
+	})
+	groups[1].Selected = false
+	state := NewJobState(dir, "https://paste.test/?abc", groups)
+	writeFile(t, dir, "Game.part1.rar", 10)
+
+	if err := state.SetStatus("https://fake.test/a#Game.part1.rar", StatusDone, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetStatus("https://fake.test/b#Game.part2.rar", StatusFailed, "timeout: request failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetServedBy("https://fake.test/b#Game.part2.rar", "https://mirror.test/c#Game.part2.rar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetStatus("https://fake.test/z#unknown.bin", StatusDone, ""); err == nil {
+		t.Error("SetStatus accepted a file outside the job")
+	}
+
+	// The state is written to a temporary file and renamed into place, so a
+	// crash while writing leaves only the temporary file incomplete
+	if _, err := os.Stat(filepath.Join(dir, stateFileName+".tmp")); err == nil {
+		t.Error("temporary state file was left behind")
+	}
+	if err := os.WriteFile(filepath.Join(dir, stateFileName+".tmp"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadJobState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the selected group's files are part of the job
+	if want := []string{"https://fake.test/a#Game.part1.rar", "https://fake.test/b#Game.part2.rar"}; !reflect.DeepEqual(loaded.Links(), want) {
+		t.Errorf("links %v, want %v", loaded.Links(), want)
+	}
+
+	tests := []struct {
+		url    string
+		status FileStatus
+		size   int64
+	}{
+		{"https://fake.test/a#Game.part1.rar", StatusDone, 10},
+		{"https://fake.test/b#Game.part2.rar", StatusFailed, 0},
+	}
+	for _, test := range tests {
+		if status := loaded.Status(test.url); status != test.status {
+			t.Errorf("status of %s = %s, want %s", test.url, status, test.status)
+		}
+		if size := loaded.RecordedSize(test.url); size != test.size {
+			t.Errorf("recorded size of %s = %d, want %d", test.url, size, test.size)
+		}
+	}
+	if want := []string{"https://fake.test/b#Game.part2.rar", "https://mirror.test/c#Game.part2.rar"}; !reflect.DeepEqual(loaded.Sources(want[0]), want) {
+		t.Errorf("sources %v, want %v", loaded.Sources(want[0]), want)
+	}
+	if loaded.SourceURL != "https://paste.test/?abc" || loaded.UpdatedAt.IsZero() {
+		t.Errorf("source %q updated at %v", loaded.SourceURL, loaded.UpdatedAt)
+	}
+}
+
+func TestLoadJobStateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"missing", "", "no saved job found"},
+		{"corrupt", `{"source_url": "https://paste.test/?abc", "files": [`, "corrupt state file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.contents != "" {
+				if err := os.WriteFile(filepath.Join(dir, stateFileName), []byte(test.contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := LoadJobState(dir)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadJobState returned %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readURLList reads newline-separated URLs from a file, or from stdin when the
+// path is "-". Blank lines and lines starting with # are ignored. kind names
+// the file in error messages.
+func readURLList(path, kind string) ([]string, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s: %w", kind, err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
+			return nil, fmt.Errorf("invalid URL in %s: %s", kind, line)
+		}
+		if !seen[line] {
+			seen[line] = true
+			urls = append(urls, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", kind, err)
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs found in %s", kind)
+	}
+	return urls, nil
+}
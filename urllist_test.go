@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadURLList(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+		err      string
+	}{
+		{"comments, blanks and duplicates",
+			"# Some Game\n\nhttps://fuckingfast.co/a#Game.part1.rar\r\n  https://fuckingfast.co/b#Game.part2.rar  \nhttps://fuckingfast.co/a#Game.part1.rar\n",
+			[]string{"https://fuckingfast.co/a#Game.part1.rar", "https://fuckingfast.co/b#Game.part2.rar"}, ""},
+		{"not a URL", "https://fuckingfast.co/a#Game.part1.rar\nGame.part2.rar\n", nil, "invalid URL in links file: Game.part2.rar"},
+		{"only comments", "# nothing yet\n\n", nil, "no URLs found in links file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "links.txt")
+			if err := os.WriteFile(path, []byte(test.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			urls, err := readURLList(path, "links file")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(urls, test.want) {
+				t.Errorf("urls %v, want %v", urls, test.want)
+			}
+		})
+	}
+
+	if _, err := readURLList(filepath.Join(t.TempDir(), "missing.txt"), "queue file"); err == nil || !strings.Contains(err.Error(), "could not open queue file") {
+		t.Errorf("missing file returned %v", err)
+	}
+}
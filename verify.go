@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// md5LineRegex matches md5sum style lines: "<hash> *<name>" or "<hash>  <name>"
+var md5LineRegex = regexp.MustCompile(`^([0-9a-fA-F]{32})\s+\*?(.+)$`)
+
+// ChecksumManifest maps lowercase file names to their expected MD5 hex digest
+type ChecksumManifest map[string]string
+
+// loadChecksumManifest parses an md5sum style listing such as fitgirl-bins.md5
+func loadChecksumManifest(path string) (ChecksumManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := make(ChecksumManifest)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		// Skip blank lines and comments (";" is used by FitGirl's listings)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		matches := md5LineRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		manifest.add(matches[2], matches[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// add records a checksum under the base name of the (possibly Windows) path
+func (m ChecksumManifest) add(name, hash string) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), `\`, "/")
+	m[strings.ToLower(filepath.Base(name))] = strings.ToLower(hash)
+}
+
+// Expected returns the checksum listed for a file name, if any
+func (m ChecksumManifest) Expected(filename string) (string, bool) {
+	hash, ok := m[strings.ToLower(filepath.Base(filename))]
+	return hash, ok
+}
+
+// Verify hashes the file and compares it with the manifest. known is false when
+// the manifest has no entry for the file, in which case ok is meaningless.
+func (m ChecksumManifest) Verify(path string) (ok bool, known bool, err error) {
+	expected, known := m.Expected(path)
+	if !known {
+		return false, false, nil
+	}
+
+	actual, err := fileMD5(path)
+	if err != nil {
+		return false, true, err
+	}
+	return actual == expected, true, nil
+}
+
+// mismatched returns the links whose files in dir do not match their listed
+// checksum; files without a checksum are not checked
+func (m ChecksumManifest) mismatched(dir string, links []string) []string {
+	var bad []string
+	for _, link := range links {
+		ok, known, err := m.Verify(filepath.Join(dir, extractFilenameFromURL(link)))
+		if known && (err != nil || !ok) {
+			bad = append(bad, link)
+		}
+	}
+	return bad
+}
+
+// findChecksumManifests looks for *.md5 listings in the download directory and
+// in an MD5 folder inside it, as shipped with FitGirl repacks
+func findChecksumManifests(dir string) []string {
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join(dir, "*.md5"),
+		filepath.Join(dir, "MD5", "*.md5"),
+		filepath.Join(dir, "md5", "*.md5"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// loadChecksums loads the manifest given with --md5, or every manifest found in
+// the download directory. Returns an empty manifest when none is available.
+func loadChecksums(config Config) (ChecksumManifest, error) {
+	paths := []string{config.ChecksumFile}
+	if config.ChecksumFile == "" {
+		paths = findChecksumManifests(config.DownloadDir)
+	}
+
+	manifest := make(ChecksumManifest)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		// On case-insensitive filesystems the MD5 and md5 globs overlap
+		if abs, err := filepath.Abs(path); err == nil {
+			if seen[strings.ToLower(abs)] {
+				continue
+			}
+			seen[strings.ToLower(abs)] = true
+		}
+
+		loaded, err := loadChecksumManifest(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read checksum manifest %s: %w", path, err)
+		}
+		for name, hash := range loaded {
+			manifest[name] = hash
+		}
+		log.Printf("Loaded %d checksums from %s", len(loaded), path)
+	}
+
+	return manifest, nil
+}
+
+// fileMD5 returns the lowercase hex MD5 digest of a file
+func fileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// runVerify checks every file listed in the checksum manifest against the
+// download directory without downloading anything. Returns the number of
+// files that are missing or do not match.
+func runVerify(config Config) (int, error) {
+	manifest, err := loadChecksums(config)
+	if err != nil {
+		return 0, err
+	}
+	if len(manifest) == 0 {
+		return 0, fmt.Errorf("no checksum manifest found in %s (use --md5 to specify one)", config.DownloadDir)
+	}
+
+	names := make([]string, 0, len(manifest))
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Map lowercase names back to the files on disk
+	onDisk := make(map[string]string)
+	entries, err := os.ReadDir(config.DownloadDir)
+	if err != nil {
+		return 0, fmt.Errorf("could not read download directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			onDisk[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+
+	okCount, badCount, missingCount := 0, 0, 0
+	for _, name := range names {
+		actualName, exists := onDisk[name]
+		if !exists {
+			fmt.Printf("MISSING  %s\n", name)
+			missingCount++
+			continue
+		}
+
+		ok, _, err := manifest.Verify(filepath.Join(config.DownloadDir, actualName))
+		switch {
+		case err != nil:
+			fmt.Printf("ERROR    %s: %v\n", actualName, err)
+			badCount++
+		case !ok:
+			fmt.Printf("FAILED   %s\n", actualName)
+			badCount++
+		default:
+			fmt.Printf("OK       %s\n", actualName)
+			okCount++
+		}
+	}
+
+	fmt.Printf("\nVerified %d files: %d OK, %d failed, %d missing\n",
+		len(names), okCount, badCount, missingCount)
+	return badCount + missingCount, nil
+}
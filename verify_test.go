@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadChecksumManifest(t *testing.T) {
+	listing := "\ufeff; Generated by FitGirl\r\n" +
+		"# comment\n" +
+		"\n" +
+		"D41D8CD98F00B204E9800998ECF8427E *MD5\\..\\fg-01.bin\n" +
+		"9e107d9d372bb6826bd81d3542a419d6  setup.exe\n" +
+		"not a checksum line\n" +
+		"e4d909c290d0fb1ca068ffaddf22cbd0 *Game/Game.part01.rar\n"
+	path := filepath.Join(t.TempDir(), "fitgirl-bins.md5")
+	if err := os.WriteFile(path, []byte(listing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := loadChecksumManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChecksumManifest{
+		"fg-01.bin":       "d41d8cd98f00b204e9800998ecf8427e",
+		"setup.exe":       "9e107d9d372bb6826bd81d3542a419d6",
+		"game.part01.rar": "e4d909c290d0fb1ca068ffaddf22cbd0",
+	}
+	if !reflect.DeepEqual(manifest, want) {
+		t.Errorf("manifest %v, want %v", manifest, want)
+	}
+}
+
+func TestChecksumManifestVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "good.bin", 0)
+	writeFile(t, dir, "bad.bin", 10)
+	writeFile(t, dir, "unlisted.bin", 10)
+	manifest := ChecksumManifest{
+		// MD5 of the empty file
+		"good.bin":    "d41d8cd98f00b204e9800998ecf8427e",
+		"bad.bin":     "d41d8cd98f00b204e9800998ecf8427e",
+		"missing.bin": "d41d8cd98f00b204e9800998ecf8427e",
+	}
+
+	tests := []struct {
+		name      string
+		ok, known bool
+		err       bool
+	}{
+		{"good.bin", true, true, false},
+		{"bad.bin", false, true, false},
+		{"unlisted.bin", false, false, false},
+		{"missing.bin", false, true, true},
+	}
+	for _, test := range tests {
+		ok, known, err := manifest.Verify(filepath.Join(dir, test.name))
+		if ok != test.ok || known != test.known || (err != nil) != test.err {
+			t.Errorf("Verify(%s) = %v, %v, %v; want %v, %v, error %v", test.name, ok, known, err, test.ok, test.known, test.err)
+		}
+	}
+
+	links := []string{
+		"https://fake.test/a#good.bin",
+		"https://fake.test/b#bad.bin",
+		"https://fake.test/c#unlisted.bin",
+		"https://fake.test/d#missing.bin",
+	}
+	if got, want := manifest.mismatched(dir, links), []string{links[1], links[3]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mismatched %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// splitScheme is one way of numbering the volumes of a split archive or a set
+// of numbered files
+type splitScheme struct {
+	// regex captures the base name and the volume number, ignoring case
+	regex *regexp.Regexp
+	// suffix is added to the base name in the group key, keeping sets of
+	// different schemes with the same base name apart. It starts with #,
+	// which no filename contains, so a set never shares a key with a file
+	// that is not a volume.
+	suffix string
+	// first is the number of the first numbered volume
+	first int
+	// format names a volume from the base name, the digit count and the number
+	format string
+	// unnumbered is the extension of the volume without a number that the
+	// scheme needs as well: base.rar before base.r00, base.zip after base.z01
+	unnumbered string
+	// unnumberedLast tells whether the unnumbered volume comes last
+	unnumberedLast bool
+}
+
+// splitSchemes are tried in order; the first match decides
+var splitSchemes = []*splitScheme{
+	// Game.part001.rar, Game.part_1.rar
+	{regex: regexp.MustCompile(`(?i)^(.+?)\.part[_.]?(\d+)\.rar$`), suffix: "#part", first: 1, format: "%s.part%0*d.rar"},
+	// Game.7z.001, Game.zip.001
+	{regex: regexp.MustCompile(`(?i)^(.+\.[a-z0-9]+)\.(\d{3})$`), suffix: "#split", first: 1, format: "%s.%0*d"},
+	// Game.rar, Game.r00, Game.r01
+	{regex: regexp.MustCompile(`(?i)^(.+)\.r(\d{2,3})$`), suffix: "#rar", first: 0, format: "%s.r%0*d", unnumbered: ".rar"},
+	// Game.z01, Game.z02, Game.zip
+	{regex: regexp.MustCompile(`(?i)^(.+)\.z(\d{2,3})$`), suffix: "#zip", first: 1, format: "%s.z%0*d", unnumbered: ".zip", unnumberedLast: true},
+	// fg-01.bin, setup-fitgirl-01.bin, data_001.bin; a separator and at least
+	// two digits keep version numbers such as Game 2.0.1.bin out
+	{regex: regexp.MustCompile(`(?i)^(.+[-_.])(\d{2,3})\.bin$`), suffix: "#bin", first: 1, format: "%s%0*d.bin"},
+}
+
+// volume is one file of a split archive or numbered set
+type volume struct {
+	scheme *splitScheme
+	// key identifies the set: the lowercase base name and the scheme suffix
+	key string
+	// base is the base name in its original spelling
+	base string
+	// number is the volume number; unused for the unnumbered volume
+	number   int
+	width    int
+	numbered bool
+}
+
+// parseVolume recognises a filename as a volume of a split archive. The plain
+// .rar and .zip that start or end old-style splits are volumes as well; alone
+// they simply form a set of one.
+func parseVolume(filename string) (volume, bool) {
+	for _, scheme := range splitSchemes {
+		matches := scheme.regex.FindStringSubmatch(filename)
+		if matches == nil {
+			continue
+		}
+		number, err := strconv.Atoi(matches[2])
+		if err != nil {
+			continue
+		}
+		return volume{
+			scheme:   scheme,
+			key:      strings.ToLower(matches[1]) + scheme.suffix,
+			base:     matches[1],
+			number:   number,
+			width:    len(matches[2]),
+			numbered: true,
+		}, true
+	}
+
+	lower := strings.ToLower(filename)
+	for _, scheme := range splitSchemes {
+		if scheme.unnumbered != "" && strings.HasSuffix(lower, scheme.unnumbered) {
+			base := filename[:len(filename)-len(scheme.unnumbered)]
+			return volume{scheme: scheme, key: strings.ToLower(base) + scheme.suffix, base: base}, true
+		}
+	}
+	return volume{}, false
+}
+
+// before reports whether v comes before other in the same set
+func (v volume) before(other volume) bool {
+	if v.numbered != other.numbered {
+		// The unnumbered volume starts or ends the set
+		if v.scheme.unnumberedLast {
+			return v.numbered
+		}
+		return !v.numbered
+	}
+	return v.number < other.number
+}
+
+// name returns the filename of volume number n in the spelling of v
+func (v volume) name(n int) string {
+	return fmt.Sprintf(v.scheme.format, v.base, v.width, n)
+}
+
+// missingVolumes names the volumes absent from a set: gaps in the numbering
+// from the scheme's first number (or a lower one that is present) up to the
+// highest one, and the unnumbered volume the scheme needs
+func missingVolumes(volumes []volume) []string {
+	var numbers []int
+	var sample volume
+	hasUnnumbered := false
+	for _, v := range volumes {
+		if !v.numbered {
+			hasUnnumbered = true
+			continue
+		}
+		numbers = append(numbers, v.number)
+		sample = v
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+	sort.Ints(numbers)
+
+	var missing []string
+	if sample.scheme.unnumbered != "" && !hasUnnumbered && !sample.scheme.unnumberedLast {
+		missing = append(missing, sample.base+sample.scheme.unnumbered)
+	}
+	expected := min(sample.scheme.first, numbers[0])
+	for _, number := range numbers {
+		for ; expected < number; expected++ {
+			missing = append(missing, sample.name(expected))
+		}
+		expected = number + 1
+	}
+	if sample.scheme.unnumbered != "" && !hasUnnumbered && sample.scheme.unnumberedLast {
+		missing = append(missing, sample.base+sample.scheme.unnumbered)
+	}
+	return missing
+}
+
+// reportMissingVolumes warns about every group with gaps in its numbering,
+// before anything is downloaded
+func reportMissingVolumes(groups []FileGroup) {
+	for _, group := range groups {
+		if len(group.Missing) == 0 {
+			continue
+		}
+		names := group.Missing
+		if len(names) > 5 {
+			names = append(names[:5:5], fmt.Sprintf("and %d more", len(group.Missing)-5))
+		}
+		log.Printf("Warning: %s is incomplete; missing %d %s: %s",
+			group.Name, len(group.Missing), pluralize("volume", len(group.Missing)), strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// groupNames maps each group's name to the filenames in it
+func groupNames(groups []FileGroup) map[string][]string {
+	names := make(map[string][]string)
+	for _, group := range groups {
+		for _, link := range group.Files {
+			names[group.Name] = append(names[group.Name], extractFilenameFromURL(link))
+		}
+	}
+	return names
+}
+
+func TestGroupKeysKeepSchemesApart(t *testing.T) {
+	links := []string{
+		"https://fuckingfast.co/a#Game.zip.001",
+		"https://fuckingfast.co/b#Game.zip.002",
+		"https://fuckingfast.co/c#Game.zip",
+		"https://fuckingfast.co/d#Game.rar.sfv",
+		"https://fuckingfast.co/e#Game.rar",
+		"https://fuckingfast.co/f#Game.r00",
+	}
+	groups := groupDownloadLinks(links)
+	if len(groups) != 4 {
+		t.Fatalf("got %d groups, want 4: %v", len(groups), groupNames(groups))
+	}
+
+	want := [][]string{
+		{"Game.zip.001", "Game.zip.002"},
+		{"Game.zip"},
+		{"Game.rar.sfv"},
+		{"Game.rar", "Game.r00"},
+	}
+	for i, group := range groups {
+		var files []string
+		for _, link := range group.Files {
+			files = append(files, extractFilenameFromURL(link))
+		}
+		if !reflect.DeepEqual(files, want[i]) {
+			t.Errorf("group %d holds %v, want %v", i, files, want[i])
+		}
+	}
+}
+
+func TestMissingVolumes(t *testing.T) {
+	links := []string{
+		"https://fuckingfast.co/a#Game.part01.rar",
+		"https://fuckingfast.co/b#Game.part02.rar",
+		"https://fuckingfast.co/c#Game.part05.rar",
+		"https://fuckingfast.co/d#Old.r00",
+		"https://fuckingfast.co/e#Old.r01",
+	}
+	groups := groupDownloadLinks(links)
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2: %v", len(groups), groupNames(groups))
+	}
+	if want := []string{"Game.part03.rar", "Game.part04.rar"}; !reflect.DeepEqual(groups[0].Missing, want) {
+		t.Errorf("missing %v, want %v", groups[0].Missing, want)
+	}
+	if want := []string{"Old.rar"}; !reflect.DeepEqual(groups[1].Missing, want) {
+		t.Errorf("missing %v, want %v", groups[1].Missing, want)
+	}
+}
+
+func TestNumberedBinNeedsSeparatorAndDigits(t *testing.T) {
+	tests := []struct {
+		filename string
+		volume   bool
+		number   int
+	}{
+		{"fg-01.bin", true, 1},
+		{"Game_--_fitgirl-repacks.site_--_fg-12.bin", true, 12},
+		{"setup-fitgirl-01.bin", true, 1},
+		{"data_001.bin", true, 1},
+		{"Game 2.0.1.bin", false, 0},
+		{"data1.bin", false, 0},
+		{"fg-selective-english.bin", false, 0},
+	}
+	for _, test := range tests {
+		vol, ok := parseVolume(test.filename)
+		if ok != test.volume || (ok && vol.number != test.number) {
+			t.Errorf("parseVolume(%q) = %d, %v; want %d, %v", test.filename, vol.number, ok, test.number, test.volume)
+		}
+	}
+
+	groups := groupDownloadLinks([]string{"https://fuckingfast.co/a#Game 2.0.1.bin"})
+	if len(groups) != 1 || groups[0].Category != CategoryOther || len(groups[0].Missing) != 0 {
+		t.Errorf("Game 2.0.1.bin was grouped as %+v", groups)
+	}
+}